@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/files"
+	"vigilis/internal/logger"
+	"vigilis/internal/recorders"
+)
+
+type command struct {
+	name        string
+	arguments   string
+	description string
+	run         func(args []string) int // Returns the exit code
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "", "record the cameras until stopped (default)", runCommand},
+		{"validate", "", "parse and validate the config, exiting with an error if it's not valid", validateCommand},
+		{"cameras", "[-json]", "list the cameras and the directories of their recordings", camerasCommand},
+		{"recordings", "[-camera id] [-from time] [-to time] [-json]", "list the recordings", recordingsCommand},
+		{"purge", "[-dry-run]", "delete the old recordings and the ones over the quotas", purgeCommand},
+		{"probe", "[-json] <camera>", "check the camera stream and print its codecs", probeCommand},
+		{"export", "-camera id -from time -to time -o file [-timestamp]", "export a clip of a camera", exportCommand},
+	}
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+
+	return nil
+}
+
+func usage() {
+	output := flag.CommandLine.Output()
+
+	fmt.Fprintf(output, "Usage: vigilis [flags] [command] [arguments]\n\nCommands:\n")
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %v %v\t%v\n", command.name, command.arguments, command.description)
+	}
+	w.Flush()
+
+	fmt.Fprintf(output, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// timeLayouts are the accepted times of the commands, the ones without a time zone are local
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		parsed, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown time format %q", value)
+}
+
+// openIndex opens the recordings index, exiting if it fails
+func openIndex() {
+	err := files.OpenIndex()
+	if err != nil {
+		logger.Fatal("Unable to open the recordings index at %v: %v", config.Current().Storage.IndexPath, err)
+	}
+}
+
+// newFlagSet returns the flags of a command, the config file can also be set after the command name
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&configFile, "c", configFile, configUsage)
+	flags.StringVar(&configFile, "config", configFile, configUsage)
+
+	return flags
+}
+
+// parseFlags parses the arguments of a command without positional arguments, returning false if they're not valid
+func parseFlags(flags *flag.FlagSet, args []string) bool {
+	if flags.Parse(args) != nil {
+		return false
+	}
+
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "Unexpected arguments: %v\n", strings.Join(flags.Args(), " "))
+		flags.Usage()
+		return false
+	}
+
+	return true
+}
+
+func printJSON(data any) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(data)
+	if err != nil {
+		logger.Error("Unable to write the output: %v", err)
+		return 1
+	}
+
+	return 0
+}
+
+// validateCommand checks the config without starting anything
+func validateCommand(args []string) int {
+	logger.SetupQuiet(debug)
+
+	flags := newFlagSet("validate")
+	if !parseFlags(flags, args) {
+		return 2
+	}
+
+	c, err := config.LoadFromFile(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config %v is not valid:\n%v\n", configFile, err)
+		return 1
+	}
+
+	fmt.Printf("Config %v is valid, %d camera(s) configured\n", configFile, len(c.Cameras))
+	return 0
+}
+
+func camerasCommand(args []string) int {
+	logger.SetupQuiet(debug)
+
+	var asJSON bool
+	flags := newFlagSet("cameras")
+	flags.BoolVar(&asJSON, "json", false, "print the cameras as JSON")
+	if !parseFlags(flags, args) {
+		return 2
+	}
+
+	config.ReadFromFile(configFile)
+
+	type cameraOutput struct {
+		Id         string `json:"id"`
+		Name       string `json:"name"`
+		RecordMode string `json:"record_mode"`
+		Live       bool   `json:"live"`
+		Directory  string `json:"directory"`
+	}
+
+	configured := config.Current().Cameras
+	cameras := make([]cameraOutput, 0, len(configured))
+	for _, camera := range configured {
+		cameras = append(cameras, cameraOutput{
+			Id:         camera.Id,
+			Name:       camera.Name,
+			RecordMode: camera.RecordMode,
+			Live:       camera.LiveEnabled(),
+			Directory:  files.CameraDir(camera),
+		})
+	}
+
+	if asJSON {
+		return printJSON(cameras)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tRECORD MODE\tLIVE\tDIRECTORY")
+	for _, camera := range cameras {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", camera.Id, camera.Name, camera.RecordMode, camera.Live, camera.Directory)
+	}
+	w.Flush()
+
+	return 0
+}
+
+func recordingsCommand(args []string) int {
+	logger.SetupQuiet(debug)
+
+	var (
+		cameraId string
+		from, to string
+		asJSON   bool
+	)
+	flags := newFlagSet("recordings")
+	flags.StringVar(&cameraId, "camera", "", "id of the camera, all cameras when not set")
+	flags.StringVar(&from, "from", "", `only the recordings after this time, for example "2025-03-14 14:00"`)
+	flags.StringVar(&to, "to", "", `only the recordings before this time, for example "2025-03-14 15:00"`)
+	flags.BoolVar(&asJSON, "json", false, "print the recordings as JSON")
+	if !parseFlags(flags, args) {
+		return 2
+	}
+
+	config.ReadFromFile(configFile)
+
+	current := config.Current()
+	cameras := current.Cameras
+	if cameraId != "" {
+		camera := current.FindCamera(cameraId)
+		if camera == nil {
+			logger.Error("Camera %q not found", cameraId)
+			return 2
+		}
+		cameras = []*config.Camera{camera}
+	}
+
+	var fromTime, toTime time.Time
+	if from != "" {
+		var err error
+		fromTime, err = parseTime(from)
+		if err != nil {
+			logger.Error("Invalid from time %q, expected for example \"2025-03-14 14:00\"", from)
+			return 2
+		}
+	}
+	if to != "" {
+		var err error
+		toTime, err = parseTime(to)
+		if err != nil {
+			logger.Error("Invalid to time %q, expected for example \"2025-03-14 15:00\"", to)
+			return 2
+		}
+	}
+
+	openIndex()
+	defer files.CloseIndex()
+
+	segments := make([]files.Segment, 0)
+	for _, camera := range cameras {
+		cameraSegments, err := files.ListSegments(camera, fromTime, toTime)
+		if err != nil {
+			logger.Error("Unable to list the recordings of camera %v: %v", camera.Id, err)
+			return 1
+		}
+
+		segments = append(segments, cameraSegments...)
+	}
+
+	if asJSON {
+		return printJSON(segments)
+	}
+
+	const layout = "2006-01-02 15:04:05"
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CAMERA\tSTART\tEND\tSIZE\tCODEC\tPATH")
+	for _, segment := range segments {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", segment.CameraId,
+			segment.Start.Local().Format(layout), segment.End.Local().Format(layout),
+			segment.Size, segment.Codec, segment.Path)
+	}
+	w.Flush()
+
+	return 0
+}
+
+func purgeCommand(args []string) int {
+	logger.SetupQuiet(debug)
+
+	var dryRun bool
+	flags := newFlagSet("purge")
+	flags.BoolVar(&dryRun, "dry-run", false, "only print the recordings that would be deleted")
+	if !parseFlags(flags, args) {
+		return 2
+	}
+
+	config.ReadFromFile(configFile)
+
+	// The recordings missing from the index are probed when it's reconciled
+	recorders.CheckFfprobe()
+
+	openIndex()
+	defer files.CloseIndex()
+
+	deletions := files.Purge(dryRun)
+
+	var bytes int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, deletion := range deletions {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", deletion.Path, deletion.Size, deletion.Reason)
+		bytes += deletion.Size
+	}
+	w.Flush()
+
+	if dryRun {
+		fmt.Printf("%d recording(s) would be deleted, %d bytes\n", len(deletions), bytes)
+	} else {
+		fmt.Printf("%d recording(s) deleted, %d bytes\n", len(deletions), bytes)
+	}
+
+	return 0
+}
+
+func probeCommand(args []string) int {
+	logger.SetupQuiet(debug)
+
+	var asJSON bool
+	flags := newFlagSet("probe")
+	flags.BoolVar(&asJSON, "json", false, "print the probe as JSON")
+	if flags.Parse(args) != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: vigilis [flags] probe [-json] <camera>")
+		return 2
+	}
+
+	config.ReadFromFile(configFile)
+
+	camera := config.Current().FindCamera(flags.Arg(0))
+	if camera == nil {
+		logger.Error("Camera %q not found", flags.Arg(0))
+		return 2
+	}
+
+	if !recorders.CheckFfprobe() {
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), recorders.ProbeTimeout)
+	defer cancel()
+
+	probe := recorders.ProbeCamera(ctx, camera)
+
+	exitCode := 0
+	if !probe.Reachable {
+		exitCode = 1
+	}
+
+	if asJSON {
+		return max(printJSON(probe), exitCode)
+	}
+
+	fmt.Printf("%v: %v\n", camera.Id, probe)
+	for _, warning := range probe.Warnings {
+		fmt.Printf("Warning: %v\n", warning)
+	}
+
+	return exitCode
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"vigilis/internal/config"
+	"vigilis/internal/export"
+	"vigilis/internal/files"
+	"vigilis/internal/logger"
+	"vigilis/internal/recorders"
+)
+
+// exportCommand exports a clip of a camera to a file, returns the exit code
+func exportCommand(args []string) int {
+	logger.Setup(debug)
+
+	var (
+		cameraId  string
+		from, to  string
+		output    string
+		timestamp bool
+	)
+	flags := newFlagSet("export")
+	flags.StringVar(&cameraId, "camera", "", "id of the camera")
+	flags.StringVar(&from, "from", "", `start of the clip, for example "2025-03-14 14:03"`)
+	flags.StringVar(&to, "to", "", `end of the clip, for example "2025-03-14 14:21"`)
+	flags.StringVar(&output, "o", "", "path of the clip file, its extension sets the format (.mp4 or .mkv)")
+	flags.BoolVar(&timestamp, "timestamp", false, "burn in the recording time, re-encoding the video")
+
+	if !parseFlags(flags, args) {
+		return 2
+	}
+
+	config.ReadFromFile(configFile)
+
+	camera := config.Current().FindCamera(cameraId)
+	if camera == nil {
+		logger.Error("Camera %q not found", cameraId)
+		return 2
+	}
+	if output == "" {
+		logger.Error("The path of the clip file is required (-o)")
+		return 2
+	}
+
+	fromTime, err := parseTime(from)
+	if err != nil {
+		logger.Error("Invalid from time %q, expected for example \"2025-03-14 14:03\"", from)
+		return 2
+	}
+	toTime, err := parseTime(to)
+	if err != nil {
+		logger.Error("Invalid to time %q, expected for example \"2025-03-14 14:21\"", to)
+		return 2
+	}
+
+	options := export.Options{
+		Camera:    camera,
+		From:      fromTime,
+		To:        toTime,
+		Format:    strings.TrimPrefix(filepath.Ext(output), "."),
+		Timestamp: timestamp,
+	}
+
+	recorders.CheckFfmpeg()
+
+	openIndex()
+	defer files.CloseIndex()
+
+	clip, err := export.Prepare(options)
+	if err != nil {
+		logger.Error("Unable to export the clip: %v", err)
+		return 1
+	}
+	defer clip.Close()
+
+	logger.Info("Exporting %d recording(s) of camera %v to %v...", len(clip.Segments), camera.Id, output)
+
+	// Stop ffmpeg if interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cmd := clip.Command(ctx, output)
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		logger.Error("Unable to export the clip: %v", err)
+		return 1
+	}
+
+	logger.Info("Clip exported to %v", output)
+	return 0
+}
@@ -2,13 +2,20 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
 	"time"
+	"vigilis/internal/api"
 	"vigilis/internal/config"
 	"vigilis/internal/files"
 	"vigilis/internal/logger"
+	"vigilis/internal/mqtt"
+	"vigilis/internal/notify"
 	"vigilis/internal/recorders"
 )
 
@@ -21,8 +28,9 @@ var (
 
 var version = "0.0.0-development" // Version is automatically set when building
 
+const configUsage = "path to the config file"
+
 func init() {
-	const configUsage = "path to the config file"
 	flag.StringVar(&configFile, "c", configFile, configUsage)
 	flag.StringVar(&configFile, "config", configFile, configUsage)
 
@@ -33,11 +41,43 @@ func init() {
 }
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 
+	// Record when no command is given
+	name := flag.Arg(0)
+	if name == "" {
+		name = "run"
+	}
+
+	command := findCommand(name)
+	if command == nil {
+		fmt.Fprintf(flag.CommandLine.Output(), "Unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	var args []string
+	if flag.NArg() > 1 {
+		args = flag.Args()[1:]
+	}
+
+	exitCode := command.run(args)
+
+	// Flush the logger before exiting, deferred calls don't run with os.Exit
+	logger.Stop()
+	os.Exit(exitCode)
+}
+
+// runCommand records the cameras until stopped, returns the exit code
+func runCommand(args []string) int {
+	flags := newFlagSet("run")
+	if !parseFlags(flags, args) {
+		return 2
+	}
+
 	// Setup the logger
 	logger.Setup(debug)
-	defer logger.Stop()
 
 	logger.Info("Starting Vigilis v%s", version)
 
@@ -48,7 +88,7 @@ func main() {
 	// Load the config
 	config.ReadFromFile(configFile)
 	if dumpConfig && debug {
-		prettyConfig, err := json.MarshalIndent(config.Vigilis, "", "  ")
+		prettyConfig, err := json.MarshalIndent(config.Current(), "", "  ")
 		if err != nil {
 			logger.Error("Unable to dump config: %v", err)
 		} else {
@@ -56,27 +96,57 @@ func main() {
 		}
 	}
 
+	// Start sending notifications, a missing ffmpeg is notified too
+	notify.Snapshot = recorders.Snapshot
+	notify.Setup(config.Current().Notifications)
+
 	// Check for dependencies
 	recorders.CheckFfmpeg()
+	recorders.CheckFfprobe()
+
+	// Open the recordings index, it's reconciled with the disk when purging
+	openIndex()
 
 	// Initialize the camera recorders
-	recorders.Init(config.Vigilis.Cameras)
+	recorders.Init(config.Current().Cameras)
+
+	// Start the HTTP API
+	api.Start()
+
+	// Publish the state of the cameras to MQTT
+	mqtt.Start(version)
 
 	// Delete old recordings
 	go files.DeleteOldRecordings()
 
-	run()
+	return run()
 }
 
-// Main application loop
-func run() {
+// Main application loop, returns the exit code
+func run() int {
 	tick := time.Tick(time.Second * 1)
-	recordingTick := time.Tick(recorders.RecordingLengthMinutes * time.Minute)
+	purgeTicker := time.NewTicker(config.Current().Storage.PurgeInterval)
+	defer purgeTicker.Stop()
+
+	// Capture SIGINT/SIGTERM to stop the recorders before exiting
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	// Capture SIGHUP to reload the config
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
 
 	for {
 		select {
-		// TODO Channel to capture SIGINT/SIGTERM on vigilis
-		case <-recordingTick:
+		case sig := <-signals:
+			// Restore the default behaviour so a second signal terminates immediately
+			signal.Stop(signals)
+			return shutdown(sig)
+		case <-reloadSignals:
+			if reload() {
+				purgeTicker.Reset(config.Current().Storage.PurgeInterval)
+			}
+		case <-purgeTicker.C:
 			// Periodically delete old recordings
 			go files.DeleteOldRecordings()
 		case <-tick:
@@ -85,6 +155,79 @@ func run() {
 	}
 }
 
+// reload re-reads the config file and applies it to the recorders that changed.
+// The current config is kept if the new one is not valid.
+func reload() bool {
+	logger.Info("Reloading the config...")
+
+	newConfig, err := config.LoadFromFile(configFile)
+	if err != nil {
+		logger.Error("Config reload rejected, keeping the current config.\n%v", err)
+		return false
+	}
+
+	current := config.Current()
+
+	// The ffmpeg binary is only checked at startup
+	if newConfig.Recorder.FfmpegPath != current.Recorder.FfmpegPath {
+		logger.Warn("Changing ffmpeg_path requires a restart, keeping %v", current.Recorder.FfmpegPath)
+		newConfig.Recorder.FfmpegPath = current.Recorder.FfmpegPath
+	}
+
+	// The index is only opened at startup
+	if newConfig.Storage.IndexPath != current.Storage.IndexPath {
+		logger.Warn("Changing the index path requires a restart, keeping %v", current.Storage.IndexPath)
+		newConfig.Storage.IndexPath = current.Storage.IndexPath
+	}
+
+	if newConfig.Recorder.FfprobePath != current.Recorder.FfprobePath {
+		logger.Warn("Changing ffprobe_path requires a restart, keeping %v", current.Recorder.FfprobePath)
+		newConfig.Recorder.FfprobePath = current.Recorder.FfprobePath
+	}
+
+	// The HTTP server is only started at startup
+	if !reflect.DeepEqual(newConfig.Http, current.Http) {
+		logger.Warn("Changing the http section requires a restart, keeping the current one")
+		newConfig.Http = current.Http
+	}
+
+	// The MQTT client is only connected at startup
+	if !reflect.DeepEqual(newConfig.Mqtt, current.Mqtt) {
+		logger.Warn("Changing the mqtt section requires a restart, keeping the current one")
+		newConfig.Mqtt = current.Mqtt
+	}
+
+	config.Apply(newConfig)
+	notify.Setup(newConfig.Notifications)
+	recorders.Reload(newConfig.Cameras)
+
+	logger.Info("Config reloaded")
+	return true
+}
+
+// shutdown stops the recorders so the current segments are finalized
+func shutdown(sig os.Signal) int {
+	logger.Info("Received %v, shutting down...", sig)
+
+	api.Stop()
+
+	// The recorders index their last segment when stopping
+	err := errors.Join(recorders.Shutdown(), files.CloseIndex())
+
+	// Send the pending notifications
+	notify.Stop()
+
+	// Mark vigilis as offline
+	mqtt.Stop()
+	if err != nil {
+		logger.Error("Vigilis did not shut down cleanly:\n%v", err)
+		return 1
+	}
+
+	logger.Info("Vigilis stopped")
+	return 0
+}
+
 func printVersion(_ string) error {
 	fmt.Printf("v%s\n", version)
 	os.Exit(0)
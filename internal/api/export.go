@@ -0,0 +1,60 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"vigilis/internal/export"
+	"vigilis/internal/logger"
+	"vigilis/internal/util"
+)
+
+// exportClip concatenates and trims the recordings between the from and to RFC 3339 query parameters.
+// The format query parameter is mp4 (default) or mkv, and timestamp=true burns in the recording time.
+func exportClip(w http.ResponseWriter, r *http.Request) {
+	camera := findCamera(w, r)
+	if camera == nil {
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+	if from.IsZero() || to.IsZero() {
+		writeError(w, http.StatusBadRequest, "from and to times are required")
+		return
+	}
+
+	clip, err := export.Prepare(export.Options{
+		Camera:    camera,
+		From:      from,
+		To:        to,
+		Format:    r.URL.Query().Get("format"),
+		Timestamp: r.URL.Query().Get("timestamp") == "true",
+	})
+	if errors.Is(err, export.ErrNoRecordings) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer clip.Close()
+
+	// The process is killed if the client disconnects
+	var stderr bytes.Buffer
+	cmd := clip.Command(r.Context(), "")
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	w.Header().Set("Content-Type", clip.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+clip.Filename()+`"`)
+
+	err = cmd.Run()
+	if err != nil && r.Context().Err() == nil {
+		logger.Warn("HTTP > Error exporting a clip of camera %v: %v", camera.Id, err)
+		util.LogBufferTail(stderr, 10, "stderr", logger.Warn, "HTTP")
+	}
+}
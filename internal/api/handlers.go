@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/files"
+	"vigilis/internal/logger"
+	"vigilis/internal/recorders"
+)
+
+type cameraResponse struct {
+	Id     string                    `json:"id"`
+	Name   string                    `json:"name"`
+	Live   string                    `json:"live,omitempty"` // URL of the HLS playlist, when enabled
+	Status *recorders.RecorderStatus `json:"status"`         // Missing while the recorder is being replaced
+}
+
+type triggerResponse struct {
+	CameraId       string    `json:"camera_id"`
+	TriggeredUntil time.Time `json:"triggered_until"` // Until when the recordings are kept
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		logger.Warn("HTTP > Error writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+// findCamera returns the camera in the request path, writing an error response if it doesn't exist
+func findCamera(w http.ResponseWriter, r *http.Request) *config.Camera {
+	camera := config.Current().FindCamera(r.PathValue("camera"))
+	if camera == nil {
+		writeError(w, http.StatusNotFound, "camera not found")
+	}
+
+	return camera
+}
+
+// findSegment returns the segment in the request path, writing an error response if it doesn't exist
+func findSegment(w http.ResponseWriter, r *http.Request, camera *config.Camera) (files.Segment, error) {
+	segment, err := files.FindSegment(camera, r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "recording not found")
+	}
+
+	return segment, err
+}
+
+func buildCameraResponses() []cameraResponse {
+	statuses := make(map[string]recorders.RecorderStatus)
+	for _, status := range recorders.Status() {
+		statuses[status.CameraId] = status
+	}
+
+	configured := config.Current().Cameras
+	cameras := make([]cameraResponse, 0, len(configured))
+	for _, camera := range configured {
+		response := cameraResponse{Id: camera.Id, Name: camera.Name}
+		if camera.LiveEnabled() {
+			response.Live = "/live/" + camera.Id + "/" + recorders.LivePlaylist
+		}
+		if status, ok := statuses[camera.Id]; ok {
+			response.Status = &status
+		}
+
+		cameras = append(cameras, response)
+	}
+
+	return cameras
+}
+
+func listCameras(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, buildCameraResponses())
+}
+
+func getCamera(w http.ResponseWriter, r *http.Request) {
+	camera := findCamera(w, r)
+	if camera == nil {
+		return
+	}
+
+	for _, response := range buildCameraResponses() {
+		if response.Id == camera.Id {
+			writeJSON(w, http.StatusOK, response)
+			return
+		}
+	}
+}
+
+// parseTimeRange returns the from and to RFC 3339 query parameters, zero when missing.
+// An error response is written if they are not valid.
+func parseTimeRange(w http.ResponseWriter, r *http.Request) (from time.Time, to time.Time, ok bool) {
+	from, ok = parseTimeParam(w, r, "from")
+	if !ok {
+		return from, to, false
+	}
+
+	to, ok = parseTimeParam(w, r, "to")
+	return from, to, ok
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter, zero when it's not set.
+// It writes the error and returns false when it's not valid.
+func parseTimeParam(w http.ResponseWriter, r *http.Request, name string) (time.Time, bool) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return time.Time{}, true
+	}
+
+	parsed, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid "+name+" time, expected RFC 3339")
+		return time.Time{}, false
+	}
+
+	return parsed, true
+}
+
+// listRecordings lists the segments of a camera, optionally filtered by the from and to RFC 3339 query parameters
+func listRecordings(w http.ResponseWriter, r *http.Request) {
+	camera := findCamera(w, r)
+	if camera == nil {
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+
+	segments, err := files.ListSegments(camera, from, to)
+	if err != nil {
+		logger.Error("HTTP > Error listing recordings of camera %v: %v", camera.Id, err)
+		writeError(w, http.StatusInternalServerError, "unable to list recordings")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, segments)
+}
+
+// listMotion returns the motion events of a camera, optionally filtered by time range
+func listMotion(w http.ResponseWriter, r *http.Request) {
+	camera := findCamera(w, r)
+	if camera == nil {
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := files.ListMotion(camera, from, to)
+	if err != nil {
+		logger.Error("HTTP > Error listing motion events of camera %v: %v", camera.Id, err)
+		writeError(w, http.StatusInternalServerError, "unable to list motion events")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
+
+// triggerRecording keeps the recordings of a camera with the events record around now, for example
+// when called by the webhook of a doorbell. The optional source query parameter is logged.
+func triggerRecording(w http.ResponseWriter, r *http.Request) {
+	camera := findCamera(w, r)
+	if camera == nil {
+		return
+	}
+
+	source := "API"
+	if name := r.URL.Query().Get("source"); name != "" {
+		source = fmt.Sprintf("API (%q)", name)
+	}
+
+	until, err := recorders.Trigger(camera.Id, source)
+	switch {
+	case errors.Is(err, recorders.ErrNotEventRecording):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		// The recorder is being replaced by a config reload
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, triggerResponse{CameraId: camera.Id, TriggeredUntil: until})
+}
+
+// downloadRecording serves a segment file, supporting Range requests
+func downloadRecording(w http.ResponseWriter, r *http.Request) {
+	camera := findCamera(w, r)
+	if camera == nil {
+		return
+	}
+
+	segment, err := findSegment(w, r, camera)
+	if err != nil {
+		return
+	}
+
+	file, err := os.Open(segment.Path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "recording not found")
+		return
+	}
+	defer file.Close()
+
+	// Recordings may be in subdirectories
+	filename := camera.Id + "-" + strings.ReplaceAll(segment.Name, "/", "-")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	http.ServeContent(w, r, segment.Name, segment.End, file)
+}
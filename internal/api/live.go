@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"vigilis/internal/config"
+)
+
+// liveContentTypes are the files written by the HLS muxer that can be served
+var liveContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+}
+
+// serveLive serves the HLS playlist and segments written by the recorder of a camera
+func serveLive(w http.ResponseWriter, r *http.Request) {
+	camera := findCamera(w, r)
+	if camera == nil {
+		return
+	}
+
+	if !camera.LiveEnabled() {
+		writeError(w, http.StatusNotFound, "live view is disabled for this camera")
+		return
+	}
+
+	name := r.PathValue("name")
+	contentType, ok := liveContentTypes[path.Ext(name)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	// The playlist changes all the time, don't let it be cached
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	http.ServeFile(w, r, path.Join(config.Current().Live.Path, camera.Id, name))
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/logger"
+	"vigilis/internal/metrics"
+)
+
+// ShutdownTimeout is how long to wait for the ongoing requests when stopping the server
+const ShutdownTimeout = 5 * time.Second
+
+var server *http.Server
+
+// Start starts the HTTP server in the background, if it is enabled in the config
+func Start() {
+	httpConfig := config.Current().Http
+	if httpConfig == nil {
+		logger.Trace("HTTP server disabled")
+		return
+	}
+
+	server = &http.Server{
+		Addr:              httpConfig.Listen,
+		Handler:           routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.Info("HTTP server listening on %v", httpConfig.Listen)
+
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP server stopped: %v", err)
+		}
+	}()
+}
+
+// Stop gracefully stops the HTTP server
+func Stop() {
+	if server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		logger.Warn("Error stopping the HTTP server: %v", err)
+	}
+}
+
+func routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/cameras", listCameras)
+	mux.HandleFunc("GET /api/cameras/{camera}", getCamera)
+	mux.HandleFunc("GET /api/cameras/{camera}/recordings", listRecordings)
+	mux.HandleFunc("GET /api/cameras/{camera}/recordings/{name...}", downloadRecording)
+	mux.HandleFunc("GET /api/cameras/{camera}/play/{name...}", playRecording)
+	mux.HandleFunc("GET /api/cameras/{camera}/export", exportClip)
+	mux.HandleFunc("GET /api/cameras/{camera}/motion", listMotion)
+	mux.HandleFunc("POST /api/cameras/{camera}/trigger", triggerRecording)
+
+	mux.HandleFunc("GET /live/{camera}/{name}", serveLive)
+
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	// Web UI
+	mux.Handle("GET /", http.FileServerFS(webFiles()))
+
+	return mux
+}
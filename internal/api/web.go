@@ -0,0 +1,48 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"os/exec"
+	"vigilis/internal/logger"
+	"vigilis/internal/recorders"
+)
+
+//go:embed web
+var web embed.FS
+
+// webFiles returns the files of the web UI
+func webFiles() fs.FS {
+	files, err := fs.Sub(web, "web")
+	if err != nil {
+		panic("web UI files not embedded: " + err.Error())
+	}
+
+	return files
+}
+
+// playRecording remuxes a segment to fragmented MP4 on the fly, so it can be played by browsers
+func playRecording(w http.ResponseWriter, r *http.Request) {
+	camera := findCamera(w, r)
+	if camera == nil {
+		return
+	}
+
+	segment, err := findSegment(w, r, camera)
+	if err != nil {
+		return
+	}
+
+	// The process is killed if the client disconnects
+	path, args := recorders.BuildRemuxCommand(segment.Path)
+	cmd := exec.CommandContext(r.Context(), path, args...)
+	cmd.Stdout = w
+
+	w.Header().Set("Content-Type", "video/mp4")
+
+	err = cmd.Run()
+	if err != nil && r.Context().Err() == nil {
+		logger.Warn("HTTP > Error remuxing recording %v of camera %v: %v", segment.Name, camera.Id, err)
+	}
+}
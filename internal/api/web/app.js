@@ -0,0 +1,187 @@
+"use strict";
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+const state = {
+    camera: null,
+    segments: [],
+};
+
+const elements = {
+    cameras: document.getElementById("cameras"),
+    viewer: document.getElementById("viewer"),
+    cameraName: document.getElementById("camera-name"),
+    day: document.getElementById("day"),
+    live: document.getElementById("live"),
+    player: document.getElementById("player"),
+    nowPlaying: document.getElementById("now-playing"),
+    hours: document.getElementById("timeline-hours"),
+    segments: document.getElementById("timeline-segments"),
+    empty: document.getElementById("timeline-empty"),
+};
+
+async function fetchJSON(url) {
+    const response = await fetch(url);
+    if (!response.ok) {
+        throw new Error(`${url}: ${response.status}`);
+    }
+    return response.json();
+}
+
+// Recordings may be in subdirectories of the camera directory
+function recordingPath(segment) {
+    return segment.name.split("/").map(encodeURIComponent).join("/");
+}
+
+function recordingUrl(segment) {
+    return `/api/cameras/${encodeURIComponent(segment.camera_id)}/recordings/${recordingPath(segment)}`;
+}
+
+function playUrl(segment) {
+    return `/api/cameras/${encodeURIComponent(segment.camera_id)}/play/${recordingPath(segment)}`;
+}
+
+// Formats a date as YYYY-MM-DD in the local timezone
+function formatDay(date) {
+    const pad = (n) => String(n).padStart(2, "0");
+    return `${date.getFullYear()}-${pad(date.getMonth() + 1)}-${pad(date.getDate())}`;
+}
+
+async function loadCameras() {
+    const cameras = await fetchJSON("/api/cameras");
+
+    elements.cameras.replaceChildren(...cameras.map((camera) => {
+        const button = document.createElement("button");
+        button.classList.toggle("selected", state.camera?.id === camera.id);
+        button.addEventListener("click", () => selectCamera(camera));
+
+        const name = document.createElement("span");
+        name.textContent = camera.name;
+
+        const status = document.createElement("span");
+        const cameraState = camera.status?.state ?? "unknown";
+        status.className = `state ${cameraState}`;
+        status.textContent = cameraState;
+
+        button.append(name, status);
+        button.title = describeProbe(camera.status?.probe);
+
+        const item = document.createElement("li");
+        item.append(button);
+        return item;
+    }));
+}
+
+// describeProbe summarizes the streams of the camera, shown when hovering it
+function describeProbe(probe) {
+    if (!probe) {
+        return "";
+    }
+    if (!probe.reachable) {
+        return `Unreachable: ${probe.error}`;
+    }
+
+    const audio = probe.audio ? `audio ${probe.audio_codec}` : "no audio";
+    const lines = [`${probe.video_codec} ${probe.width}x${probe.height} at ${probe.fps} fps, ${audio}`];
+    for (const warning of probe.warnings ?? []) {
+        lines.push(`Warning: ${warning}`);
+    }
+
+    return lines.join("\n");
+}
+
+function selectCamera(camera) {
+    state.camera = camera;
+    elements.viewer.hidden = false;
+    elements.cameraName.textContent = camera.name;
+    elements.live.hidden = !camera.live;
+    elements.player.removeAttribute("src");
+    elements.nowPlaying.textContent = "";
+
+    loadCameras();
+    loadTimeline();
+}
+
+async function loadTimeline() {
+    const dayStart = new Date(`${elements.day.value}T00:00:00`);
+    const dayEnd = new Date(dayStart.getTime() + DAY_MS);
+
+    const params = new URLSearchParams({from: dayStart.toISOString(), to: dayEnd.toISOString()});
+    state.segments = await fetchJSON(`/api/cameras/${encodeURIComponent(state.camera.id)}/recordings?${params}`);
+
+    elements.empty.hidden = state.segments.length > 0;
+    elements.segments.replaceChildren(...state.segments.map((segment) => {
+        const start = Math.max(new Date(segment.start).getTime(), dayStart.getTime());
+        const end = Math.min(new Date(segment.end).getTime(), dayEnd.getTime());
+
+        const block = document.createElement("div");
+        block.style.left = `${(start - dayStart.getTime()) / DAY_MS * 100}%`;
+        block.style.width = `${Math.max(end - start, 0) / DAY_MS * 100}%`;
+        block.title = `${new Date(segment.start).toLocaleTimeString()} - ${new Date(segment.end).toLocaleTimeString()}`;
+        block.addEventListener("click", () => play(segment, block));
+        return block;
+    }));
+}
+
+function clearPlaying() {
+    for (const playing of elements.segments.querySelectorAll(".playing")) {
+        playing.classList.remove("playing");
+    }
+}
+
+function playLive() {
+    clearPlaying();
+    elements.nowPlaying.textContent = "Live";
+
+    // HLS is only supported natively by some browsers, link to the playlist for external players otherwise
+    if (!elements.player.canPlayType("application/vnd.apple.mpegurl")) {
+        elements.player.removeAttribute("src");
+
+        const playlist = document.createElement("a");
+        playlist.href = state.camera.live;
+        playlist.textContent = "Open the live playlist in an external player";
+        elements.nowPlaying.replaceChildren("Live view is not supported by this browser. ", playlist);
+        return;
+    }
+
+    elements.player.src = state.camera.live;
+}
+
+function play(segment, block) {
+    clearPlaying();
+    block.classList.add("playing");
+
+    elements.player.src = playUrl(segment);
+    elements.nowPlaying.innerHTML = "";
+
+    const download = document.createElement("a");
+    download.href = recordingUrl(segment);
+    download.textContent = "Download";
+    elements.nowPlaying.append(`${new Date(segment.start).toLocaleString()} `, download);
+}
+
+// Plays the next segment when the current one ends
+elements.player.addEventListener("ended", () => {
+    const blocks = [...elements.segments.children];
+    const index = blocks.findIndex((block) => block.classList.contains("playing"));
+    if (index >= 0 && index + 1 < blocks.length) {
+        play(state.segments[index + 1], blocks[index + 1]);
+    }
+});
+
+elements.live.addEventListener("click", playLive);
+elements.day.addEventListener("change", () => state.camera && loadTimeline());
+
+function init() {
+    elements.day.value = formatDay(new Date());
+    elements.hours.replaceChildren(...Array.from({length: 24}, (_, hour) => {
+        const label = document.createElement("span");
+        label.textContent = String(hour).padStart(2, "0");
+        return label;
+    }));
+
+    loadCameras();
+    setInterval(loadCameras, 10000);
+}
+
+init();
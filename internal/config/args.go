@@ -0,0 +1,83 @@
+package config
+
+import (
+	"slices"
+	"strings"
+)
+
+// Arguments that can't be customized as the recorder or the segmenter depend on them.
+// Output arguments starting with -segment_ or -hls_ are also reserved.
+var (
+	reservedInputArgs      = []string{"-i", "-y", "-n", "-loglevel", "-v", "-hide_banner"}
+	reservedOutputArgs     = []string{"-i", "-y", "-n", "-f", "-map", "-strftime", "-reset_timestamps"}
+	reservedOutputPrefixes = []string{"-segment_", "-hls_"}
+)
+
+// isOption checks if the ffmpeg argument is an option rather than a value, negative numbers are values
+func isOption(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-' && !strings.ContainsRune("0123456789.", rune(arg[1]))
+}
+
+// SplitOptions groups the ffmpeg arguments by option, each group starting with the option followed by its values.
+// Values before the first option are grouped together.
+func SplitOptions(args []string) [][]string {
+	var options [][]string
+	for _, arg := range args {
+		if isOption(arg) || len(options) == 0 {
+			options = append(options, []string{arg})
+			continue
+		}
+
+		options[len(options)-1] = append(options[len(options)-1], arg)
+	}
+
+	return options
+}
+
+// uniqueOptions checks if no option is set twice in the ffmpeg arguments
+func uniqueOptions(args []string) bool {
+	seen := make(map[string]bool)
+	for _, option := range SplitOptions(args) {
+		if !isOption(option[0]) {
+			continue
+		}
+		if seen[option[0]] {
+			return false
+		}
+		seen[option[0]] = true
+	}
+
+	return true
+}
+
+// mergeArgs appends the ffmpeg arguments of a camera to the global ones,
+// the options set in both only keep the values of the camera
+func mergeArgs(global []string, camera []string) []string {
+	cameraOptions := SplitOptions(camera)
+
+	merged := make([]string, 0, len(global)+len(camera))
+	for _, option := range SplitOptions(global) {
+		overridden := slices.ContainsFunc(cameraOptions, func(cameraOption []string) bool {
+			return isOption(option[0]) && cameraOption[0] == option[0]
+		})
+		if !overridden {
+			merged = append(merged, option...)
+		}
+	}
+
+	return append(merged, camera...)
+}
+
+func checkInputArg(arg string) bool {
+	return !slices.Contains(reservedInputArgs, arg)
+}
+
+func checkOutputArg(arg string) bool {
+	if slices.Contains(reservedOutputArgs, arg) {
+		return false
+	}
+
+	return !slices.ContainsFunc(reservedOutputPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(arg, prefix)
+	})
+}
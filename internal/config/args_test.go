@@ -0,0 +1,46 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeArgs(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Global   []string
+		Camera   []string
+		Expected []string
+	}{
+		{
+			Name:     "no-camera-args",
+			Global:   DefaultInputArgs,
+			Expected: DefaultInputArgs,
+		},
+		{
+			Name:     "appended",
+			Global:   []string{"-rtsp_transport", "tcp"},
+			Camera:   []string{"-timeout", "5000000"},
+			Expected: []string{"-rtsp_transport", "tcp", "-timeout", "5000000"},
+		},
+		{
+			Name:     "option-replaced",
+			Global:   DefaultInputArgs,
+			Camera:   []string{"-rtsp_transport", "udp"},
+			Expected: []string{"-use_wallclock_as_timestamps", "1", "-rtsp_transport", "udp"},
+		},
+		{
+			Name:     "option-without-value",
+			Global:   []string{"-an", "-itsoffset", "-1.5"},
+			Camera:   []string{"-itsoffset", "2"},
+			Expected: []string{"-an", "-itsoffset", "2"},
+		},
+	}
+
+	for _, caseData := range cases {
+		merged := mergeArgs(caseData.Global, caseData.Camera)
+		if !slices.Equal(merged, caseData.Expected) {
+			t.Errorf("%v: wanted %q, got %q", caseData.Name, caseData.Expected, merged)
+		}
+	}
+}
@@ -3,7 +3,11 @@ package config
 import (
 	"github.com/go-playground/validator/v10"
 	"github.com/goccy/go-yaml"
+	"path"
 	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,31 +19,274 @@ type (
 		Cameras []*Camera `yaml:"cameras" validate:"required,gt=0,unique=Id,dive"`
 
 		Recorder *Recorder `yaml:"recorder" validate:"omitempty"`
+
+		Http *Http `yaml:"http" validate:"omitempty"`
+
+		Live *Live `yaml:"live" validate:"omitempty"`
+
+		Notifications *Notifications `yaml:"notifications" validate:"omitempty"`
+
+		Mqtt *Mqtt `yaml:"mqtt" validate:"omitempty"`
 	}
 
 	Storage struct {
-		Path          string `yaml:"path" validate:"required,dirpath,gte=1"`
-		RetentionDays int    `yaml:"retention_days" validate:"required,number,gte=1"`
+		Path          string        `yaml:"path" validate:"required,dirpath,gte=1"`
+		RetentionDays int           `yaml:"retention_days" validate:"required,number,gte=1"`
+		PurgeInterval time.Duration `yaml:"purge_interval" validate:"omitempty,gte=1m,lte=24h"` // How often old recordings are deleted
+		MaxBytes      string        `yaml:"max_bytes" validate:"omitempty,size"`                // Maximum size of all the recordings
+		MinFreeBytes  string        `yaml:"min_free_bytes" validate:"omitempty,size"`           // Free space to keep on the filesystem
+		PathTemplate  string        `yaml:"path_template" validate:"omitempty,path_template"`   // Where the recordings are stored, relative to Path
+		IndexPath     string        `yaml:"index_path" validate:"omitempty,filepath"`           // Database of the recordings, defaults to a file in Path
 	}
 
 	Camera struct {
-		Id        string `yaml:"id" validate:"required,slug,gte=1,lte=20"`
-		Name      string `yaml:"name" validate:"required,gte=1,lte=30"`
-		StreamUrl string `yaml:"stream_url" validate:"required,url,gte=8"`
+		Id         string   `yaml:"id" validate:"required,slug,gte=1,lte=20"`
+		Name       string   `yaml:"name" validate:"required,gte=1,lte=30"`
+		StreamUrl  string   `yaml:"stream_url" validate:"required,url,gte=8"`
+		RecordMode string   `yaml:"record_mode" validate:"omitempty,oneof=direct video-only reencode"`
+		Encoder    *Encoder `yaml:"encoder" validate:"omitempty"`
+		InputArgs  []string `yaml:"input_args" validate:"omitempty,ffmpeg_unique_options,dive,ffmpeg_input_arg"`   // Appended to Recorder.InputArgs, replacing the same options
+		OutputArgs []string `yaml:"output_args" validate:"omitempty,ffmpeg_unique_options,dive,ffmpeg_output_arg"` // Appended to Recorder.OutputArgs, replacing the same options
+
+		SegmentSeconds int `yaml:"segment_seconds" validate:"omitempty,gte=10,lte=3600"` // Replaces Recorder.SegmentSeconds
+
+		Record         string          `yaml:"record" validate:"omitempty,oneof=continuous events"` // Which recordings are kept
+		EventRecording *EventRecording `yaml:"event_recording" validate:"omitempty"`                // Only used when Record is events
+
+		Live *bool `yaml:"live"` // Defaults to true when the live section is present
+
+		RetentionDays int    `yaml:"retention_days" validate:"omitempty,number,gte=1"` // Replaces Storage.RetentionDays
+		MaxBytes      string `yaml:"max_bytes" validate:"omitempty,size"`              // Maximum size of the recordings of this camera
+
+		EmailTo []string `yaml:"email_to" validate:"omitempty,dive,email"` // Replaces Email.To for the events of this camera
+
+		Motion *Motion `yaml:"motion" validate:"omitempty"` // Motion detection, disabled when not set
+	}
+
+	// EventRecording keeps the recordings around the triggers of the camera, the others are only buffered
+	EventRecording struct {
+		PreRoll  time.Duration `yaml:"pre_roll" validate:"omitempty,lte=10m"` // Kept before each trigger
+		PostRoll time.Duration `yaml:"post_roll" validate:"omitempty,lte=1h"` // Kept after each trigger, and after the motion ended
+	}
+
+	// Motion detects motion by comparing small grayscale frames decoded from the stream
+	Motion struct {
+		Fps         float64       `yaml:"fps" validate:"omitempty,gt=0,lte=10"`       // Frames compared per second
+		Width       int           `yaml:"width" validate:"omitempty,gte=32,lte=1280"` // Size of the compared frames
+		Height      int           `yaml:"height" validate:"omitempty,gte=32,lte=720"`
+		Sensitivity int           `yaml:"sensitivity" validate:"omitempty,gte=1,lte=100"` // Higher detects smaller brightness changes
+		MinArea     float64       `yaml:"min_area" validate:"omitempty,gt=0,lte=100"`     // Percentage of the frame that must change
+		Cooldown    time.Duration `yaml:"cooldown" validate:"omitempty,gte=1s"`           // Motion ends after this long without changes
+		Masks       []*MotionMask `yaml:"masks" validate:"omitempty,dive"`                // Zones of the frame that are ignored
+	}
+
+	// MotionMask is a rectangle of the frame, in percentages of its size from the top left corner
+	MotionMask struct {
+		X      float64 `yaml:"x" validate:"gte=0,lte=100"`
+		Y      float64 `yaml:"y" validate:"gte=0,lte=100"`
+		Width  float64 `yaml:"width" validate:"gt=0,lte=100"`
+		Height float64 `yaml:"height" validate:"gt=0,lte=100"`
+	}
+
+	// Encoder configures the H.264 encoder used by the reencode record mode
+	Encoder struct {
+		Crf    int    `yaml:"crf" validate:"omitempty,gte=1,lte=51"`
+		Preset string `yaml:"preset" validate:"omitempty,oneof=ultrafast superfast veryfast faster fast medium slow slower veryslow"`
+	}
+
+	// Http enables the HTTP API when present
+	Http struct {
+		Listen string `yaml:"listen" validate:"required,hostname_port"` // Address to listen on, for example :8080
+	}
+
+	// Live enables the HLS live view of the cameras, written by the recording process
+	Live struct {
+		Path           string `yaml:"path" validate:"required,dirpath"`                  // Where the playlists are written, preferably a tmpfs
+		SegmentSeconds int    `yaml:"segment_seconds" validate:"omitempty,gte=1,lte=10"` // Length of each HLS segment
+		ListSize       int    `yaml:"list_size" validate:"omitempty,gte=2,lte=20"`       // Segments kept in the playlist
+	}
+
+	// Notifications sends events, like cameras going down, to external services
+	Notifications struct {
+		Webhooks          []*Webhook    `yaml:"webhooks" validate:"omitempty,dive"`
+		Email             *Email        `yaml:"email" validate:"omitempty"`
+		DiskFreeThreshold string        `yaml:"disk_free_threshold" validate:"omitempty,size"` // Notify when the free space is under this
+		OutageThreshold   time.Duration `yaml:"outage_threshold" validate:"omitempty,gte=1m"`  // Notify when a camera isn't recorded for this long
+	}
+
+	Webhook struct {
+		Url    string   `yaml:"url" validate:"required,http_url"`
+		Secret string   `yaml:"secret"`                                 // Signs the requests with HMAC-SHA256, when set
+		Events []string `yaml:"events" validate:"omitempty,dive,event"` // Defaults to DefaultWebhookEvents
+	}
+
+	// Email sends the events by SMTP
+	Email struct {
+		Host     string        `yaml:"host" validate:"required,hostname|ip"`
+		Port     int           `yaml:"port" validate:"omitempty,gte=1,lte=65535"`             // Defaults to 587, or 465 with tls security
+		Security string        `yaml:"security" validate:"omitempty,oneof=starttls tls none"` // Defaults to starttls
+		Username string        `yaml:"username"`
+		Password string        `yaml:"password"`
+		From     string        `yaml:"from" validate:"required,email"`
+		To       []string      `yaml:"to" validate:"required,gt=0,dive,email"`
+		Events   []string      `yaml:"events" validate:"omitempty,dive,event"` // Defaults to DefaultEmailEvents
+		Digest   time.Duration `yaml:"digest" validate:"omitempty,gte=1m"`     // Group the events in a mail sent every digest, when set
+		Snapshot bool          `yaml:"snapshot"`                               // Attach a picture of the camera to its events
+	}
+
+	// Mqtt publishes the state of the cameras to a broker and accepts commands to start and stop them
+	Mqtt struct {
+		Broker          string `yaml:"broker" validate:"required,url"` // For example tcp://localhost:1883 or ssl://broker:8883
+		ClientId        string `yaml:"client_id"`                      // Defaults to vigilis
+		Username        string `yaml:"username"`
+		Password        string `yaml:"password"`
+		TopicPrefix     string `yaml:"topic_prefix" validate:"omitempty,excludesall=+#"`     // Defaults to vigilis
+		Discovery       *bool  `yaml:"discovery"`                                            // Home Assistant discovery, defaults to true
+		DiscoveryPrefix string `yaml:"discovery_prefix" validate:"omitempty,excludesall=+#"` // Defaults to homeassistant
 	}
 
 	Recorder struct {
-		FfmpegPath string `yaml:"ffmpeg_path" validate:"filepath"`
+		FfmpegPath  string   `yaml:"ffmpeg_path" validate:"filepath"`
+		FfprobePath string   `yaml:"ffprobe_path" validate:"omitempty,filepath"`                                    // Defaults to ffprobe next to ffmpeg
+		InputArgs   []string `yaml:"input_args" validate:"omitempty,ffmpeg_unique_options,dive,ffmpeg_input_arg"`   // ffmpeg arguments placed before the input
+		OutputArgs  []string `yaml:"output_args" validate:"omitempty,ffmpeg_unique_options,dive,ffmpeg_output_arg"` // ffmpeg arguments placed after the codec arguments
+
+		SegmentSeconds int           `yaml:"segment_seconds" validate:"omitempty,gte=10,lte=3600"` // Length of each recording file
+		StallTimeout   time.Duration `yaml:"stall_timeout" validate:"omitempty,gte=10s,lte=10m"`   // Restart ffmpeg when no data is written for this long
 	}
 )
 
-var Vigilis = VigilisConfig{
-	Recorder: &Recorder{
-		FfmpegPath: "ffmpeg",
-	},
+const (
+	RecordModeDirect    = "direct"     // Copy the audio and video streams as they are
+	RecordModeVideoOnly = "video-only" // Copy the video stream, dropping the audio
+	RecordModeReencode  = "reencode"   // Re-encode the video stream to H.264
+)
+
+const (
+	RecordContinuous = "continuous" // Keep all the recordings
+	RecordEvents     = "events"     // Only keep the recordings around the triggers: motion, API and MQTT
+)
+
+const (
+	EmailSecurityStartTls = "starttls" // Upgrade the connection with STARTTLS, failing if the server doesn't support it
+	EmailSecurityTls      = "tls"      // Connect with TLS
+	EmailSecurityNone     = "none"     // Plain text, only for local relays
+)
+
+const (
+	DefaultEncoderCrf    = 23
+	DefaultEncoderPreset = "veryfast"
+
+	DefaultSegmentSeconds = 10 * 60
+	DefaultPurgeInterval  = 10 * time.Minute
+	DefaultStallTimeout   = 30 * time.Second
+
+	DefaultLiveSegmentSeconds = 2
+	DefaultLiveListSize       = 5
+
+	DefaultOutageThreshold = 10 * time.Minute
+
+	DefaultEventSegmentSeconds = 10 // Shorter segments keep less footage around the triggers
+	DefaultEventPreRoll        = 10 * time.Second
+	DefaultEventPostRoll       = 30 * time.Second
+
+	DefaultMotionFps         = 2
+	DefaultMotionWidth       = 320
+	DefaultMotionHeight      = 180
+	DefaultMotionSensitivity = 50
+	DefaultMotionMinArea     = 1
+	DefaultMotionCooldown    = 10 * time.Second
+
+	DefaultEmailSecurity = EmailSecurityStartTls
+	DefaultEmailPort     = 587 // Submission port, with STARTTLS
+	DefaultEmailTlsPort  = 465 // Submission port with implicit TLS
+
+	DefaultMqttClientId        = "vigilis"
+	DefaultMqttTopicPrefix     = "vigilis"
+	DefaultMqttDiscoveryPrefix = "homeassistant"
+)
+
+// DefaultIndexFile is the name of the recordings database in the storage directory.
+// It can't conflict with a camera directory, as camera ids don't have dots.
+const DefaultIndexFile = "vigilis.db"
+
+// Events that can be notified
+const (
+	EventRecorderFailed    = "recorder_failed"    // The recorder failed too many times and is retried less often
+	EventRecorderRecovered = "recorder_recovered" // A failed recorder is running again
+	EventStallDetected     = "stall_detected"     // The camera stopped sending data
+	EventDiskAlmostFull    = "disk_almost_full"   // The free space is under notifications.disk_free_threshold
+	EventPurgeError        = "purge_error"        // Old recordings couldn't be deleted
+	EventFfmpegMissing     = "ffmpeg_missing"     // ffmpeg was not found at startup
+	EventCameraOutage      = "camera_outage"      // The camera was not recorded for notifications.outage_threshold
+	EventMotionStart       = "motion_start"       // Motion was detected on the camera
+	EventMotionEnd         = "motion_end"         // No motion was detected on the camera for motion.cooldown
+)
+
+var Events = []string{
+	EventRecorderFailed, EventRecorderRecovered, EventStallDetected,
+	EventDiskAlmostFull, EventPurgeError, EventFfmpegMissing, EventCameraOutage,
+	EventMotionStart, EventMotionEnd,
+}
+
+// DefaultEmailEvents are mailed when no events are set, the others would flood the inbox
+var DefaultEmailEvents = []string{EventRecorderFailed, EventCameraOutage, EventDiskAlmostFull, EventFfmpegMissing}
+
+// DefaultWebhookEvents are sent when no events are set, motion is opt-in as it's sent on every movement
+var DefaultWebhookEvents = []string{
+	EventRecorderFailed, EventRecorderRecovered, EventStallDetected,
+	EventDiskAlmostFull, EventPurgeError, EventFfmpegMissing, EventCameraOutage,
+}
+
+// DefaultInputArgs are used when no input arguments are set in the config
+var DefaultInputArgs = []string{
+	"-rtsp_transport", "tcp",
+	"-use_wallclock_as_timestamps", "1",
+}
+
+// current is the config in use. It's replaced as a whole on reload and must not be modified,
+// readers take a single snapshot with Current for each operation.
+var current atomic.Pointer[VigilisConfig]
+
+func init() {
+	current.Store(defaultConfig())
+}
+
+// Current returns the config in use
+func Current() *VigilisConfig {
+	return current.Load()
 }
 
+// Apply replaces the config in use
+func Apply(c *VigilisConfig) {
+	current.Store(c)
+}
+
+// defaultConfig returns the config values used when they are not in the config file
+func defaultConfig() *VigilisConfig {
+	return &VigilisConfig{
+		Recorder: &Recorder{
+			FfmpegPath: "ffmpeg",
+		},
+	}
+}
+
+// Parse decodes and validates the config, applying it if successful
 func Parse(data []byte) error {
+	c, err := Load(data)
+	if err != nil {
+		return err
+	}
+
+	Apply(c)
+
+	return nil
+}
+
+// Load decodes and validates a new config without applying it
+func Load(data []byte) (*VigilisConfig, error) {
+	c := defaultConfig()
+
 	// Setup the data validator
 	validate := validator.New(validator.WithRequiredStructEnabled())
 
@@ -49,24 +296,299 @@ func Parse(data []byte) error {
 		return regex.MatchString(fl.Field().String())
 	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Register the custom validator for sizes, absolute or percentages
+	err = validate.RegisterValidation("size", func(fl validator.FieldLevel) bool {
+		_, err := ParseSize(fl.Field().String())
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Register the custom validator for the recordings path template
+	err = validate.RegisterValidation("path_template", func(fl validator.FieldLevel) bool {
+		return checkPathTemplate(fl.Field().String()) == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Register the custom validator for notification events
+	err = validate.RegisterValidation("event", func(fl validator.FieldLevel) bool {
+		return slices.Contains(Events, fl.Field().String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Register the custom validators for ffmpeg arguments that would conflict with the recorder
+	err = validate.RegisterValidation("ffmpeg_input_arg", func(fl validator.FieldLevel) bool {
+		return checkInputArg(fl.Field().String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = validate.RegisterValidation("ffmpeg_output_arg", func(fl validator.FieldLevel) bool {
+		return checkOutputArg(fl.Field().String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Register the custom validator for ffmpeg arguments setting an option twice
+	err = validate.RegisterValidation("ffmpeg_unique_options", func(fl validator.FieldLevel) bool {
+		args, ok := fl.Field().Interface().([]string)
+		return ok && uniqueOptions(args)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Try to decode the config
-	err = yaml.UnmarshalWithOptions(data, &Vigilis, yaml.Strict())
+	err = yaml.UnmarshalWithOptions(data, c, yaml.Strict())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Try to validate the config
-	err = validate.Struct(&Vigilis)
+	err = validate.Struct(c)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	c.setDefaults()
+
+	return c, nil
+}
+
+// FindCamera returns the camera with the given id, or nil if it doesn't exist
+func (c *VigilisConfig) FindCamera(id string) *Camera {
+	for _, camera := range c.Cameras {
+		if camera.Id == id {
+			return camera
+		}
 	}
 
 	return nil
 }
 
+// setDefaults fills the optional values that were not set in the config file
+func (c *VigilisConfig) setDefaults() {
+	if c.Storage.PurgeInterval == 0 {
+		c.Storage.PurgeInterval = DefaultPurgeInterval
+	}
+	if c.Storage.PathTemplate == "" {
+		c.Storage.PathTemplate = DefaultPathTemplate
+	}
+	if c.Storage.IndexPath == "" {
+		c.Storage.IndexPath = path.Join(c.Storage.Path, DefaultIndexFile)
+	}
+
+	if c.Recorder == nil {
+		c.Recorder = &Recorder{FfmpegPath: "ffmpeg"}
+	}
+	if c.Recorder.FfprobePath == "" {
+		c.Recorder.FfprobePath = path.Join(path.Dir(c.Recorder.FfmpegPath), "ffprobe")
+		if !strings.Contains(c.Recorder.FfmpegPath, "/") {
+			c.Recorder.FfprobePath = "ffprobe"
+		}
+	}
+	if c.Recorder.InputArgs == nil {
+		c.Recorder.InputArgs = DefaultInputArgs
+	}
+	if c.Recorder.SegmentSeconds == 0 {
+		c.Recorder.SegmentSeconds = DefaultSegmentSeconds
+	}
+	if c.Recorder.StallTimeout == 0 {
+		c.Recorder.StallTimeout = DefaultStallTimeout
+	}
+
+	if c.Live != nil {
+		if c.Live.SegmentSeconds == 0 {
+			c.Live.SegmentSeconds = DefaultLiveSegmentSeconds
+		}
+		if c.Live.ListSize == 0 {
+			c.Live.ListSize = DefaultLiveListSize
+		}
+	}
+
+	if c.Notifications != nil {
+		if c.Notifications.OutageThreshold == 0 {
+			c.Notifications.OutageThreshold = DefaultOutageThreshold
+		}
+
+		for _, webhook := range c.Notifications.Webhooks {
+			if webhook.Events == nil {
+				webhook.Events = DefaultWebhookEvents
+			}
+		}
+
+		if email := c.Notifications.Email; email != nil {
+			if email.Security == "" {
+				email.Security = DefaultEmailSecurity
+			}
+			if email.Port == 0 {
+				email.Port = DefaultEmailPort
+				if email.Security == EmailSecurityTls {
+					email.Port = DefaultEmailTlsPort
+				}
+			}
+			if email.Events == nil {
+				email.Events = DefaultEmailEvents
+			}
+		}
+	}
+
+	if c.Mqtt != nil {
+		if c.Mqtt.ClientId == "" {
+			c.Mqtt.ClientId = DefaultMqttClientId
+		}
+		if c.Mqtt.TopicPrefix == "" {
+			c.Mqtt.TopicPrefix = DefaultMqttTopicPrefix
+		}
+		if c.Mqtt.Discovery == nil {
+			discovery := true
+			c.Mqtt.Discovery = &discovery
+		}
+		if c.Mqtt.DiscoveryPrefix == "" {
+			c.Mqtt.DiscoveryPrefix = DefaultMqttDiscoveryPrefix
+		}
+	}
+
+	for _, camera := range c.Cameras {
+		if camera.RecordMode == "" {
+			camera.RecordMode = RecordModeDirect
+		}
+
+		if camera.Encoder == nil {
+			camera.Encoder = &Encoder{}
+		}
+		if camera.Encoder.Crf == 0 {
+			camera.Encoder.Crf = DefaultEncoderCrf
+		}
+		if camera.Encoder.Preset == "" {
+			camera.Encoder.Preset = DefaultEncoderPreset
+		}
+
+		camera.InputArgs = mergeArgs(c.Recorder.InputArgs, camera.InputArgs)
+		camera.OutputArgs = mergeArgs(c.Recorder.OutputArgs, camera.OutputArgs)
+		if camera.Record == "" {
+			camera.Record = RecordContinuous
+		}
+
+		if camera.EventRecording == nil {
+			camera.EventRecording = &EventRecording{}
+		}
+		if camera.EventRecording.PreRoll == 0 {
+			camera.EventRecording.PreRoll = DefaultEventPreRoll
+		}
+		if camera.EventRecording.PostRoll == 0 {
+			camera.EventRecording.PostRoll = DefaultEventPostRoll
+		}
+
+		if camera.SegmentSeconds == 0 {
+			camera.SegmentSeconds = c.Recorder.SegmentSeconds
+			if camera.Record == RecordEvents {
+				camera.SegmentSeconds = DefaultEventSegmentSeconds
+			}
+		}
+
+		if camera.RetentionDays == 0 {
+			camera.RetentionDays = c.Storage.RetentionDays
+		}
+
+		if motion := camera.Motion; motion != nil {
+			if motion.Fps == 0 {
+				motion.Fps = DefaultMotionFps
+			}
+			if motion.Width == 0 {
+				motion.Width = DefaultMotionWidth
+			}
+			if motion.Height == 0 {
+				motion.Height = DefaultMotionHeight
+			}
+			if motion.Sensitivity == 0 {
+				motion.Sensitivity = DefaultMotionSensitivity
+			}
+			if motion.MinArea == 0 {
+				motion.MinArea = DefaultMotionMinArea
+			}
+			if motion.Cooldown == 0 {
+				motion.Cooldown = DefaultMotionCooldown
+			}
+		}
+
+		// Live view is only available when enabled globally
+		live := c.Live != nil && (camera.Live == nil || *camera.Live)
+		camera.Live = &live
+	}
+}
+
+// EventRecordingEnabled checks if only the recordings around the triggers of the camera are kept
+func (c *Camera) EventRecordingEnabled() bool {
+	return c.Record == RecordEvents
+}
+
+// LiveEnabled checks if the live view of the camera is enabled
+func (c *Camera) LiveEnabled() bool {
+	return c.Live != nil && *c.Live
+}
+
+// Wants checks if the event is mailed
+func (e *Email) Wants(event string) bool {
+	return slices.Contains(e.Events, event)
+}
+
+// Recipients returns who receives the events of the camera, or of vigilis when nil
+func (e *Email) Recipients(camera *Camera) []string {
+	if camera != nil && len(camera.EmailTo) > 0 {
+		return camera.EmailTo
+	}
+
+	return e.To
+}
+
+// DiscoveryEnabled checks if the cameras are announced to Home Assistant
+func (m *Mqtt) DiscoveryEnabled() bool {
+	return m.Discovery != nil && *m.Discovery
+}
+
+// Quota returns the maximum size of the recordings and the free space to keep, zero when not set
+func (s *Storage) Quota() (maxBytes Size, minFreeBytes Size) {
+	// Already validated when parsing
+	maxBytes, _ = ParseSize(s.MaxBytes)
+	minFreeBytes, _ = ParseSize(s.MinFreeBytes)
+
+	return maxBytes, minFreeBytes
+}
+
+// Quota returns the maximum size of the recordings of the camera, zero when not set
+func (c *Camera) Quota() Size {
+	// Already validated when parsing
+	maxBytes, _ := ParseSize(c.MaxBytes)
+	return maxBytes
+}
+
+// FreeThreshold returns the free space under which the disk is almost full, zero when not set
+func (n *Notifications) FreeThreshold() Size {
+	// Already validated when parsing
+	threshold, _ := ParseSize(n.DiskFreeThreshold)
+	return threshold
+}
+
+// Wants checks if the event is sent to the webhook
+func (w *Webhook) Wants(event string) bool {
+	return slices.Contains(w.Events, event)
+}
+
+func (c *Camera) RetentionDaysDuration() time.Duration {
+	return time.Hour * 24 * time.Duration(c.RetentionDays)
+}
+
 func (s *Storage) RetentionDaysDuration() time.Duration {
 	return time.Hour * 24 * time.Duration(s.RetentionDays)
 }
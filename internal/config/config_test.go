@@ -94,6 +94,114 @@ storage:
 `,
 		},
 
+		{
+			Name:          "invalid-storage-short-purge-interval",
+			ExpectedError: "Key: 'VigilisConfig.Storage.PurgeInterval' Error:Field validation for 'PurgeInterval' failed on the 'gte' tag",
+			Data: `---
+storage:
+  purge_interval: 30s
+`,
+		},
+		{
+			Name:          "invalid-storage-not-a-duration-purge-interval",
+			ExpectedError: "time: invalid duration \"often\"",
+			Data: `---
+storage:
+  purge_interval: often
+`,
+		},
+		{
+			Name:             "valid-storage-purge-interval",
+			MustNotHaveError: "VigilisConfig.Storage",
+			Data: `---
+storage:
+  path: /tmp/vigilis/
+  retention_days: 1
+  purge_interval: 1h
+`,
+		},
+
+		{
+			Name:          "invalid-storage-max-bytes",
+			ExpectedError: "Key: 'VigilisConfig.Storage.MaxBytes' Error:Field validation for 'MaxBytes' failed on the 'size' tag",
+			Data: `---
+storage:
+  max_bytes: a lot
+`,
+		},
+		{
+			Name:          "invalid-storage-min-free-bytes-percentage",
+			ExpectedError: "Key: 'VigilisConfig.Storage.MinFreeBytes' Error:Field validation for 'MinFreeBytes' failed on the 'size' tag",
+			Data: `---
+storage:
+  min_free_bytes: 150%
+`,
+		},
+		{
+			Name:             "valid-storage-quota",
+			MustNotHaveError: "VigilisConfig.Storage",
+			Data: `---
+storage:
+  path: /tmp/vigilis/
+  retention_days: 1
+  max_bytes: 500GB
+  min_free_bytes: 10%
+`,
+		},
+		{
+			Name:             "valid-storage-quota-in-bytes",
+			MustNotHaveError: "VigilisConfig.Storage",
+			Data: `---
+storage:
+  path: /tmp/vigilis/
+  retention_days: 1
+  max_bytes: 1073741824
+`,
+		},
+
+		{
+			Name:          "invalid-storage-path-template-without-camera",
+			ExpectedError: "Key: 'VigilisConfig.Storage.PathTemplate' Error:Field validation for 'PathTemplate' failed on the 'path_template' tag",
+			Data: `---
+storage:
+  path_template: "%Y/%m/%d/{camera}/%H%M%S.mkv"
+`,
+		},
+		{
+			Name:          "invalid-storage-path-template-without-seconds",
+			ExpectedError: "Key: 'VigilisConfig.Storage.PathTemplate' Error:Field validation for 'PathTemplate' failed on the 'path_template' tag",
+			Data: `---
+storage:
+  path_template: "{camera}/%Y/%m/%d/%H%M.mkv"
+`,
+		},
+		{
+			Name:          "invalid-storage-path-template-escaping",
+			ExpectedError: "Key: 'VigilisConfig.Storage.PathTemplate' Error:Field validation for 'PathTemplate' failed on the 'path_template' tag",
+			Data: `---
+storage:
+  path_template: "{camera}/../%Y%m%d-%H%M%S.mkv"
+`,
+		},
+		{
+			Name:          "invalid-storage-path-template-extension",
+			ExpectedError: "Key: 'VigilisConfig.Storage.PathTemplate' Error:Field validation for 'PathTemplate' failed on the 'path_template' tag",
+			Data: `---
+storage:
+  path_template: "{camera}/%Y%m%d-%H%M%S.mp4"
+`,
+		},
+		{
+			Name:             "valid-storage-path-template",
+			MustNotHaveError: "VigilisConfig.Storage",
+			Data: `---
+storage:
+  path: /tmp/vigilis/
+  retention_days: 1
+  path_template: "{camera}/%Y/%m/%d/%H%M%S.mkv"
+`,
+		},
+
 		// Cameras
 		{
 			Name:          "invalid-cameras-no-values",
@@ -219,6 +327,264 @@ cameras:
   - id: c-d 
     name: "C D"
     stream_url: rtsp://c-d
+`,
+		},
+		{
+			Name:          "invalid-cameras-unknown-record-mode",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].RecordMode' Error:Field validation for 'RecordMode' failed on the 'oneof' tag",
+			Data: `---
+cameras:
+  - record_mode: audio-only
+`,
+		},
+		{
+			Name:             "valid-cameras-record-modes",
+			MustNotHaveError: "VigilisConfig.Cameras",
+			Data: `---
+cameras:
+  - id: a
+    name: A
+    stream_url: rtsp://a
+    record_mode: direct
+  - id: b
+    name: B
+    stream_url: rtsp://b
+    record_mode: video-only
+  - id: c
+    name: C
+    stream_url: rtsp://c
+    record_mode: reencode
+`,
+		},
+		{
+			Name:          "invalid-cameras-encoder-high-crf",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].Encoder.Crf' Error:Field validation for 'Crf' failed on the 'lte' tag",
+			Data: `---
+cameras:
+  - encoder:
+      crf: 52
+`,
+		},
+		{
+			Name:          "invalid-cameras-encoder-unknown-preset",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].Encoder.Preset' Error:Field validation for 'Preset' failed on the 'oneof' tag",
+			Data: `---
+cameras:
+  - encoder:
+      preset: fastest
+`,
+		},
+		{
+			Name:             "valid-cameras-encoder",
+			MustNotHaveError: "VigilisConfig.Cameras",
+			Data: `---
+cameras:
+  - id: a
+    name: A
+    stream_url: rtsp://a
+    record_mode: reencode
+    encoder:
+      crf: 28
+      preset: fast
+`,
+		},
+		{
+			Name:          "invalid-cameras-input-args-with-input",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].InputArgs[1]' Error:Field validation for 'InputArgs[1]' failed on the 'ffmpeg_input_arg' tag",
+			Data: `---
+cameras:
+  - input_args: ["-rtsp_transport", "-i", "rtsp://b"]
+`,
+		},
+		{
+			Name:          "invalid-cameras-output-args-with-segment-option",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].OutputArgs[0]' Error:Field validation for 'OutputArgs[0]' failed on the 'ffmpeg_output_arg' tag",
+			Data: `---
+cameras:
+  - output_args: ["-segment_time", "60"]
+`,
+		},
+		{
+			Name:          "invalid-cameras-output-args-with-format",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].OutputArgs[0]' Error:Field validation for 'OutputArgs[0]' failed on the 'ffmpeg_output_arg' tag",
+			Data: `---
+cameras:
+  - output_args: ["-f", "mp4"]
+`,
+		},
+		{
+			Name:          "invalid-cameras-input-args-duplicate-option",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].InputArgs' Error:Field validation for 'InputArgs' failed on the 'ffmpeg_unique_options' tag",
+			Data: `---
+cameras:
+  - input_args: ["-rtsp_transport", "tcp", "-rtsp_transport", "udp"]
+`,
+		},
+		{
+			Name:          "invalid-cameras-input-args-with-loglevel",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].InputArgs[0]' Error:Field validation for 'InputArgs[0]' failed on the 'ffmpeg_input_arg' tag",
+			Data: `---
+cameras:
+  - input_args: ["-loglevel", "debug"]
+`,
+		},
+		{
+			Name:          "invalid-cameras-output-args-with-live-option",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].OutputArgs[0]' Error:Field validation for 'OutputArgs[0]' failed on the 'ffmpeg_output_arg' tag",
+			Data: `---
+cameras:
+  - output_args: ["-hls_time", "4"]
+`,
+		},
+		{
+			Name:             "valid-cameras-custom-args",
+			MustNotHaveError: "VigilisConfig.Cameras",
+			Data: `---
+cameras:
+  - id: a
+    name: A
+    stream_url: rtsp://a
+    input_args: ["-rtsp_transport", "udp"]
+  - id: b
+    name: B
+    stream_url: http://b/video.mjpg
+    input_args: ["-f", "mjpeg"]
+    output_args: ["-fps_mode", "passthrough"]
+`,
+		},
+		{
+			Name:          "invalid-cameras-short-segment",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].SegmentSeconds' Error:Field validation for 'SegmentSeconds' failed on the 'gte' tag",
+			Data: `---
+cameras:
+  - segment_seconds: 5
+`,
+		},
+		{
+			Name:          "invalid-cameras-long-segment",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].SegmentSeconds' Error:Field validation for 'SegmentSeconds' failed on the 'lte' tag",
+			Data: `---
+cameras:
+  - segment_seconds: 3601
+`,
+		},
+		{
+			Name:             "valid-cameras-segment-seconds",
+			MustNotHaveError: "VigilisConfig.Cameras",
+			Data: `---
+cameras:
+  - id: a
+    name: A
+    stream_url: rtsp://a
+    segment_seconds: 60
+`,
+		},
+		{
+			Name:          "invalid-cameras-negative-retention-days",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].RetentionDays' Error:Field validation for 'RetentionDays' failed on the 'gte' tag",
+			Data: `---
+cameras:
+  - retention_days: -1
+`,
+		},
+		{
+			Name:          "invalid-cameras-max-bytes",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].MaxBytes' Error:Field validation for 'MaxBytes' failed on the 'size' tag",
+			Data: `---
+cameras:
+  - max_bytes: 10 GB per day
+`,
+		},
+		{
+			Name:             "valid-cameras-retention",
+			MustNotHaveError: "VigilisConfig.Cameras",
+			Data: `---
+cameras:
+  - id: parking
+    name: Parking
+    stream_url: rtsp://parking
+    retention_days: 30
+    max_bytes: 2TB
+  - id: lobby
+    name: Lobby
+    stream_url: rtsp://lobby
+    retention_days: 3
+`,
+		},
+		{
+			Name:          "invalid-cameras-record",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].Record' Error:Field validation for 'Record' failed on the 'oneof' tag",
+			Data: `---
+cameras:
+  - record: motion
+`,
+		},
+		{
+			Name:          "invalid-cameras-event-recording-pre-roll",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].EventRecording.PreRoll' Error:Field validation for 'PreRoll' failed on the 'lte' tag",
+			Data: `---
+cameras:
+  - record: events
+    event_recording:
+      pre_roll: 1h
+`,
+		},
+		{
+			Name:             "valid-cameras-event-recording",
+			MustNotHaveError: "VigilisConfig.Cameras",
+			Data: `---
+cameras:
+  - id: parking
+    name: Parking
+    stream_url: rtsp://parking
+    record: events
+    event_recording:
+      pre_roll: 5s
+      post_roll: 1m
+  - id: lobby
+    name: Lobby
+    stream_url: rtsp://lobby
+    record: continuous
+`,
+		},
+		{
+			Name:          "invalid-cameras-motion-sensitivity",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].Motion.Sensitivity' Error:Field validation for 'Sensitivity' failed on the 'lte' tag",
+			Data: `---
+cameras:
+  - motion:
+      sensitivity: 150
+`,
+		},
+		{
+			Name:          "invalid-cameras-motion-mask",
+			ExpectedError: "Key: 'VigilisConfig.Cameras[0].Motion.Masks[0].Width' Error:Field validation for 'Width' failed on the 'gt' tag",
+			Data: `---
+cameras:
+  - motion:
+      masks:
+        - {x: 10, y: 10, height: 20}
+`,
+		},
+		{
+			Name:             "valid-cameras-motion",
+			MustNotHaveError: "VigilisConfig.Cameras",
+			Data: `---
+cameras:
+  - id: parking
+    name: Parking
+    stream_url: rtsp://parking
+    motion:
+      fps: 1
+      sensitivity: 80
+      min_area: 0.5
+      cooldown: 30s
+      masks:
+        - {x: 0, y: 0, width: 100, height: 10}
+  - id: lobby
+    name: Lobby
+    stream_url: rtsp://lobby
+    motion: {}
 `,
 		},
 		{
@@ -242,6 +608,57 @@ recorder:
 			Data: `---
 recorder:
   ffmpeg_path: .
+`,
+		},
+		{
+			Name:          "invalid-recorder-output-args-with-strftime",
+			ExpectedError: "Key: 'VigilisConfig.Recorder.OutputArgs[0]' Error:Field validation for 'OutputArgs[0]' failed on the 'ffmpeg_output_arg' tag",
+			Data: `---
+recorder:
+  output_args: ["-strftime", "0"]
+`,
+		},
+		{
+			Name:          "invalid-recorder-output-args-duplicate-option",
+			ExpectedError: "Key: 'VigilisConfig.Recorder.OutputArgs' Error:Field validation for 'OutputArgs' failed on the 'ffmpeg_unique_options' tag",
+			Data: `---
+recorder:
+  output_args: ["-fps_mode", "passthrough", "-an", "-fps_mode", "cfr"]
+`,
+		},
+		{
+			Name:             "valid-recorder-custom-args",
+			MustNotHaveError: "VigilisConfig.Recorder",
+			Data: `---
+recorder:
+  ffmpeg_path: /usr/bin/ffmpeg
+  input_args: ["-rtsp_transport", "udp"]
+  output_args: ["-avoid_negative_ts", "make_zero"]
+`,
+		},
+		{
+			Name:          "invalid-recorder-long-segment",
+			ExpectedError: "Key: 'VigilisConfig.Recorder.SegmentSeconds' Error:Field validation for 'SegmentSeconds' failed on the 'lte' tag",
+			Data: `---
+recorder:
+  segment_seconds: 7200
+`,
+		},
+		{
+			Name:          "invalid-recorder-short-stall-timeout",
+			ExpectedError: "Key: 'VigilisConfig.Recorder.StallTimeout' Error:Field validation for 'StallTimeout' failed on the 'gte' tag",
+			Data: `---
+recorder:
+  stall_timeout: 1s
+`,
+		},
+		{
+			Name:             "valid-recorder-stall-timeout",
+			MustNotHaveError: "VigilisConfig.Recorder",
+			Data: `---
+recorder:
+  ffmpeg_path: /usr/bin/ffmpeg
+  stall_timeout: 1m
 `,
 		},
 		{
@@ -250,6 +667,178 @@ recorder:
 			Data: `---
 recorder:
   ffmpeg_path: /usr/bin/ffmpeg
+`,
+		},
+
+		// HTTP
+		{
+			Name:          "invalid-http-no-listen",
+			ExpectedError: "Key: 'VigilisConfig.Http.Listen' Error:Field validation for 'Listen' failed on the 'required' tag",
+			Data: `---
+http:
+  listen:
+`,
+		},
+		{
+			Name:          "invalid-http-listen-without-port",
+			ExpectedError: "Key: 'VigilisConfig.Http.Listen' Error:Field validation for 'Listen' failed on the 'hostname_port' tag",
+			Data: `---
+http:
+  listen: localhost
+`,
+		},
+		{
+			Name:             "valid-http-listen",
+			MustNotHaveError: "VigilisConfig.Http",
+			Data: `---
+http:
+  listen: 127.0.0.1:8080
+`,
+		},
+		{
+			Name:             "valid-http-listen-all-interfaces",
+			MustNotHaveError: "VigilisConfig.Http",
+			Data: `---
+http:
+  listen: :8080
+`,
+		},
+
+		// Live
+		{
+			Name:          "invalid-live-no-path",
+			ExpectedError: "Key: 'VigilisConfig.Live.Path' Error:Field validation for 'Path' failed on the 'required' tag",
+			Data: `---
+live:
+  list_size: 5
+`,
+		},
+		{
+			Name:          "invalid-live-long-segment",
+			ExpectedError: "Key: 'VigilisConfig.Live.SegmentSeconds' Error:Field validation for 'SegmentSeconds' failed on the 'lte' tag",
+			Data: `---
+live:
+  segment_seconds: 30
+`,
+		},
+		{
+			Name:             "valid-live",
+			MustNotHaveError: "VigilisConfig.Live",
+			Data: `---
+live:
+  path: /dev/shm/vigilis/
+  segment_seconds: 2
+  list_size: 6
+`,
+		},
+
+		// Notifications
+		{
+			Name:          "invalid-notifications-webhook-url",
+			ExpectedError: "Key: 'VigilisConfig.Notifications.Webhooks[0].Url' Error:Field validation for 'Url' failed on the 'http_url' tag",
+			Data: `---
+notifications:
+  webhooks:
+    - url: example.com/vigilis
+`,
+		},
+		{
+			Name:          "invalid-notifications-webhook-event",
+			ExpectedError: "Key: 'VigilisConfig.Notifications.Webhooks[0].Events[1]' Error:Field validation for 'Events[1]' failed on the 'event' tag",
+			Data: `---
+notifications:
+  webhooks:
+    - url: https://example.com/vigilis
+      events: [recorder_failed, camera_down]
+`,
+		},
+		{
+			Name:          "invalid-notifications-disk-free-threshold",
+			ExpectedError: "Key: 'VigilisConfig.Notifications.DiskFreeThreshold' Error:Field validation for 'DiskFreeThreshold' failed on the 'size' tag",
+			Data: `---
+notifications:
+  disk_free_threshold: 5 percent
+`,
+		},
+		{
+			Name:             "valid-notifications",
+			MustNotHaveError: "VigilisConfig.Notifications",
+			Data: `---
+notifications:
+  webhooks:
+    - url: https://example.com/vigilis
+      secret: secret
+      events: [recorder_failed, disk_almost_full]
+  disk_free_threshold: 5%
+`,
+		},
+
+		{
+			Name:          "invalid-notifications-email-no-recipients",
+			ExpectedError: "Key: 'VigilisConfig.Notifications.Email.To' Error:Field validation for 'To' failed on the 'required' tag",
+			Data: `---
+notifications:
+  email:
+    host: smtp.example.com
+    from: vigilis@example.com
+`,
+		},
+		{
+			Name:          "invalid-notifications-email-security",
+			ExpectedError: "Key: 'VigilisConfig.Notifications.Email.Security' Error:Field validation for 'Security' failed on the 'oneof' tag",
+			Data: `---
+notifications:
+  email:
+    host: smtp.example.com
+    security: ssl
+    from: vigilis@example.com
+    to: [admin@example.com]
+`,
+		},
+		{
+			Name:             "valid-notifications-email",
+			MustNotHaveError: "VigilisConfig.Notifications",
+			Data: `---
+notifications:
+  email:
+    host: smtp.example.com
+    username: vigilis
+    password: secret
+    from: vigilis@example.com
+    to: [admin@example.com, security@example.com]
+    digest: 1h
+    snapshot: true
+  outage_threshold: 15m
+`,
+		},
+
+		// MQTT
+		{
+			Name:          "invalid-mqtt-no-broker",
+			ExpectedError: "Key: 'VigilisConfig.Mqtt.Broker' Error:Field validation for 'Broker' failed on the 'required' tag",
+			Data: `---
+mqtt:
+  topic_prefix: vigilis
+`,
+		},
+		{
+			Name:          "invalid-mqtt-wildcard-prefix",
+			ExpectedError: "Key: 'VigilisConfig.Mqtt.TopicPrefix' Error:Field validation for 'TopicPrefix' failed on the 'excludesall' tag",
+			Data: `---
+mqtt:
+  broker: tcp://localhost:1883
+  topic_prefix: vigilis/#
+`,
+		},
+		{
+			Name:             "valid-mqtt",
+			MustNotHaveError: "VigilisConfig.Mqtt",
+			Data: `---
+mqtt:
+  broker: tcp://localhost:1883
+  username: vigilis
+  password: secret
+  discovery: false
 `,
 		},
 	}
@@ -271,7 +860,7 @@ recorder:
 
 			// Clear the variable between runs
 			defer func() {
-				Vigilis = VigilisConfig{}
+				Apply(&VigilisConfig{})
 			}()
 
 			err := Parse([]byte(caseData.Data))
@@ -9,18 +9,8 @@ import (
 func ReadFromFile(path string) {
 	logger.Info("Provided config file path: %v", path)
 
-	// Get the current path
-	pwd, err := os.Getwd()
-	if err != nil {
-		logger.Fatal("Unable to get current path: %v", err)
-	}
-
-	// Compute the full path
-	fullPath := filepath.Join(pwd, path)
-	logger.Info("Full path to config: %v", fullPath)
-
 	// Read the file
-	data, err := os.ReadFile(fullPath)
+	data, err := readFile(path)
 	if err != nil {
 		logger.Fatal("Unable to read config file: %v", err)
 	}
@@ -30,3 +20,27 @@ func ReadFromFile(path string) {
 		logger.Fatal("Error parsing the config.\n%v", err)
 	}
 }
+
+// LoadFromFile reads and validates the config file without applying it
+func LoadFromFile(path string) (*VigilisConfig, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(data)
+}
+
+func readFile(path string) ([]byte, error) {
+	// Get the current path
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	// Compute the full path
+	fullPath := filepath.Join(pwd, path)
+	logger.Info("Full path to config: %v", fullPath)
+
+	return os.ReadFile(fullPath)
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Size is an amount of bytes, either absolute or relative to the size of the filesystem
+type Size struct {
+	Bytes   uint64
+	Percent float64 // Used instead of Bytes when set
+}
+
+var sizeUnits = map[string]uint64{
+	"":    1,
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+}
+
+var sizeRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([a-zA-Z%]*)$`)
+
+// ParseSize parses sizes like 1073741824, 500MB, 1.5GiB or 10%
+func ParseSize(value string) (Size, error) {
+	match := sizeRegex.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return Size{}, fmt.Errorf("invalid size %q", value)
+	}
+
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return Size{}, fmt.Errorf("invalid size %q: %w", value, err)
+	}
+
+	if match[2] == "%" {
+		if number > 100 {
+			return Size{}, fmt.Errorf("invalid size %q, percentages must be up to 100%%", value)
+		}
+		return Size{Percent: number}, nil
+	}
+
+	unit, ok := sizeUnits[strings.ToUpper(match[2])]
+	if !ok {
+		return Size{}, fmt.Errorf("invalid size %q, unknown unit %v", value, match[2])
+	}
+
+	return Size{Bytes: uint64(number * float64(unit))}, nil
+}
+
+// Of returns the size in bytes, using the total size of the filesystem for percentages
+func (s Size) Of(total uint64) uint64 {
+	if s.Percent > 0 {
+		return uint64(float64(total) * s.Percent / 100)
+	}
+
+	return s.Bytes
+}
+
+// IsZero checks if the size is not set
+func (s Size) IsZero() bool {
+	return s.Bytes == 0 && s.Percent == 0
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		Value         string
+		Expected      Size
+		ExpectedError string
+	}{
+		{Value: "1073741824", Expected: Size{Bytes: 1073741824}},
+		{Value: "512B", Expected: Size{Bytes: 512}},
+		{Value: "500MB", Expected: Size{Bytes: 500_000_000}},
+		{Value: "1.5GiB", Expected: Size{Bytes: 1_610_612_736}},
+		{Value: "2 tb", Expected: Size{Bytes: 2_000_000_000_000}},
+		{Value: "10%", Expected: Size{Percent: 10}},
+		{Value: "12.5%", Expected: Size{Percent: 12.5}},
+		{Value: "101%", ExpectedError: `invalid size "101%", percentages must be up to 100%`},
+		{Value: "5PB", ExpectedError: `invalid size "5PB", unknown unit PB`},
+		{Value: "-5GB", ExpectedError: `invalid size "-5GB"`},
+		{Value: "lots", ExpectedError: `invalid size "lots"`},
+	}
+
+	for _, caseData := range cases {
+		t.Run(caseData.Value, func(t *testing.T) {
+			size, err := ParseSize(caseData.Value)
+			if caseData.ExpectedError != "" {
+				if err == nil || err.Error() != caseData.ExpectedError {
+					t.Errorf("wanted error %q, got %v", caseData.ExpectedError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if size != caseData.Expected {
+				t.Errorf("wanted %+v, got %+v", caseData.Expected, size)
+			}
+		})
+	}
+}
+
+func TestSizeOf(t *testing.T) {
+	if bytes := (Size{Bytes: 100}).Of(1000); bytes != 100 {
+		t.Errorf("absolute size: wanted 100, got %d", bytes)
+	}
+	if bytes := (Size{Percent: 10}).Of(1000); bytes != 100 {
+		t.Errorf("percentage: wanted 100, got %d", bytes)
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"vigilis/internal/util"
+)
+
+// CameraPlaceholder is replaced by the camera id in the path template
+const CameraPlaceholder = "{camera}"
+
+// DefaultPathTemplate stores the recordings of each camera in a single directory
+const DefaultPathTemplate = CameraPlaceholder + "/%Y%m%d-%H%M%S.mkv"
+
+// checkPathTemplate checks if the recordings path template can be used by the recorders and parsed back
+func checkPathTemplate(template string) error {
+	pattern, found := strings.CutPrefix(template, CameraPlaceholder+"/")
+	if !found {
+		return errors.New("the template must start with " + CameraPlaceholder + "/")
+	}
+
+	if strings.Contains(pattern, CameraPlaceholder) {
+		return errors.New(CameraPlaceholder + " can only be used once")
+	}
+
+	if path.Clean(pattern) != pattern || slices.Contains(strings.Split(pattern, "/"), "..") {
+		return errors.New("the template must be a clean relative path")
+	}
+
+	if path.Ext(pattern) != ".mkv" {
+		return errors.New("the recordings must have the .mkv extension")
+	}
+
+	// The start time of the recordings is parsed from their path
+	directives, err := util.CheckStrftime(pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, directive := range []byte("YmdHMS") {
+		if !slices.Contains(directives, directive) {
+			return errors.New("the template must contain %Y, %m, %d, %H, %M and %S")
+		}
+	}
+
+	return nil
+}
+
+// NamesSortByTime checks if the names of the recordings in a directory sort in the order they were recorded,
+// which is the case when the directives of the template go from the year to the second
+func (s *Storage) NamesSortByTime() bool {
+	directives, err := util.CheckStrftime(s.SegmentPattern())
+	if err != nil {
+		return false
+	}
+
+	// %% is a literal percent sign
+	directives = slices.DeleteFunc(directives, func(directive byte) bool {
+		return directive == '%'
+	})
+
+	return string(directives) == "YmdHMS"
+}
+
+// SegmentPattern returns the strftime pattern of the recordings, relative to the camera directory
+func (s *Storage) SegmentPattern() string {
+	return strings.TrimPrefix(s.PathTemplate, CameraPlaceholder+"/")
+}
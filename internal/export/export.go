@@ -0,0 +1,144 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/files"
+	"vigilis/internal/recorders"
+)
+
+// MaxDuration is the longest clip that can be exported at once
+const MaxDuration = 24 * time.Hour
+
+// DefaultFormat is used when no format is given
+const DefaultFormat = "mp4"
+
+var ErrNoRecordings = errors.New("no recordings in the given range")
+
+type Options struct {
+	Camera    *config.Camera
+	From      time.Time
+	To        time.Time
+	Format    string // mp4 or mkv
+	Timestamp bool   // Burn in the recording time, re-encoding the video
+}
+
+// Clip is an export ready to be run, it must be closed to remove the concat list
+type Clip struct {
+	Options
+	Segments []files.Segment
+
+	listPath string
+}
+
+// Prepare finds the recordings of the clip and writes the concat list for ffmpeg
+func Prepare(options Options) (*Clip, error) {
+	if options.Format == "" {
+		options.Format = DefaultFormat
+	}
+
+	switch {
+	case !recorders.ExportFormatSupported(options.Format):
+		return nil, fmt.Errorf("unsupported format %q, expected mp4 or mkv", options.Format)
+	case !options.From.Before(options.To):
+		return nil, errors.New("the start of the clip must be before its end")
+	case options.To.Sub(options.From) > MaxDuration:
+		return nil, fmt.Errorf("clips can't be longer than %v", MaxDuration)
+	}
+
+	segments, err := files.ListSegments(options.Camera, options.From, options.To)
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip the segments that only touch the clip range
+	segments = slices.DeleteFunc(segments, func(segment files.Segment) bool {
+		return !segment.Start.Before(options.To) || !segment.End.After(options.From)
+	})
+	if len(segments) == 0 {
+		return nil, ErrNoRecordings
+	}
+
+	list, err := os.CreateTemp("", "vigilis-export-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer list.Close()
+
+	clip := &Clip{Options: options, Segments: segments, listPath: list.Name()}
+
+	_, err = list.WriteString(clip.concatList())
+	if err != nil {
+		clip.Close()
+		return nil, err
+	}
+
+	return clip, nil
+}
+
+// concatList builds the list of the concat demuxer, trimming the first and last segments to the clip range
+// See https://ffmpeg.org/ffmpeg-formats.html#concat-1
+func (c *Clip) concatList() string {
+	var list strings.Builder
+	list.WriteString("ffconcat version 1.0\n")
+
+	for _, segment := range c.Segments {
+		// Quotes are escaped by closing the quoted string
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(segment.Path, "'", `'\''`))
+
+		if c.From.After(segment.Start) {
+			fmt.Fprintf(&list, "inpoint %.3f\n", c.From.Sub(segment.Start).Seconds())
+		}
+		if c.To.Before(segment.End) {
+			fmt.Fprintf(&list, "outpoint %.3f\n", c.To.Sub(segment.Start).Seconds())
+		}
+	}
+
+	return list.String()
+}
+
+// Command builds the ffmpeg command that writes the clip to the output file, or to stdout when empty
+func (c *Clip) Command(ctx context.Context, output string) *exec.Cmd {
+	if output == "" {
+		output = "pipe:1"
+	}
+
+	// The overlay starts at the beginning of the clip, gaps between the recordings are not accounted for
+	var overlayStart time.Time
+	if c.Timestamp {
+		overlayStart = c.From
+		if first := c.Segments[0].Start; first.After(overlayStart) {
+			overlayStart = first
+		}
+	}
+
+	path, args := recorders.BuildExportCommand(c.Camera, c.listPath, c.Format, overlayStart, output)
+	return exec.CommandContext(ctx, path, args...)
+}
+
+// Filename returns the suggested name of the clip file
+func (c *Clip) Filename() string {
+	const layout = "20060102-150405"
+	return c.Camera.Id + "-" + c.From.Local().Format(layout) + "-" + c.To.Local().Format(layout) + "." + c.Format
+}
+
+// ContentType returns the media type of the clip
+func (c *Clip) ContentType() string {
+	if c.Format == "mkv" {
+		return "video/x-matroska"
+	}
+
+	return "video/mp4"
+}
+
+// Close removes the concat list
+func (c *Clip) Close() error {
+	return os.Remove(c.listPath)
+}
@@ -0,0 +1,38 @@
+package export
+
+import (
+	"testing"
+	"time"
+	"vigilis/internal/files"
+)
+
+func TestConcatList(t *testing.T) {
+	start := time.Date(2025, 3, 14, 14, 0, 0, 0, time.Local)
+	segment := func(name string, offset time.Duration) files.Segment {
+		return files.Segment{
+			Path:  "/recordings/a/" + name,
+			Start: start.Add(offset),
+			End:   start.Add(offset + 10*time.Minute),
+		}
+	}
+
+	clip := &Clip{
+		Options: Options{From: start.Add(3 * time.Minute), To: start.Add(21*time.Minute + 30*time.Second)},
+		Segments: []files.Segment{
+			segment("140000.mkv", 0),
+			segment("it's.mkv", 10*time.Minute),
+			segment("142000.mkv", 20*time.Minute),
+		},
+	}
+
+	expected := `ffconcat version 1.0
+file '/recordings/a/140000.mkv'
+inpoint 180.000
+file '/recordings/a/it'\''s.mkv'
+file '/recordings/a/142000.mkv'
+outpoint 90.000
+`
+	if list := clip.concatList(); list != expected {
+		t.Errorf("unexpected concat list:\n%v", list)
+	}
+}
@@ -0,0 +1,92 @@
+package ffprobe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Path is the ffprobe binary, resolved by the recorders at startup. It's empty when ffprobe was not found.
+var Path string
+
+// args make ffprobe print the format and the streams of the input as JSON
+var args = []string{
+	"-v", "error",
+	"-print_format", "json",
+	"-show_format",
+	"-show_streams",
+}
+
+// Output is what ffprobe printed about the input
+type Output struct {
+	Format struct {
+		Duration string `json:"duration"` // In seconds, missing for live streams
+	} `json:"format"`
+	Streams []Stream `json:"streams"`
+}
+
+type Stream struct {
+	CodecType    string `json:"codec_type"`
+	CodecName    string `json:"codec_name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	AvgFrameRate string `json:"avg_frame_rate"`
+	RFrameRate   string `json:"r_frame_rate"`
+}
+
+// Command builds the command that probes the input, the input arguments must be accepted by ffprobe
+func Command(inputArgs []string, input string) (string, []string) {
+	return Path, slices.Concat(args, inputArgs, []string{"-i", input})
+}
+
+// Run runs the probe command, the error is what ffprobe printed when it failed
+func Run(ctx context.Context, path string, args []string) (Output, error) {
+	var output Output
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stderr = &stderr
+
+	data, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return output, errors.New(message)
+		}
+		return output, err
+	}
+
+	err = json.Unmarshal(data, &output)
+	if err != nil {
+		return output, fmt.Errorf("unexpected ffprobe output: %w", err)
+	}
+
+	return output, nil
+}
+
+// Duration returns the duration of the input, zero when it's unknown
+func (o Output) Duration() time.Duration {
+	seconds, err := strconv.ParseFloat(o.Format.Duration, 64)
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Video returns the first video stream, nil when there is none
+func (o Output) Video() *Stream {
+	for i := range o.Streams {
+		if o.Streams[i].CodecType == "video" {
+			return &o.Streams[i]
+		}
+	}
+
+	return nil
+}
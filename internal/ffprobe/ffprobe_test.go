@@ -0,0 +1,38 @@
+package ffprobe
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ffprobe")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+case "$*" in
+*missing*) echo "missing.mkv: No such file or directory" >&2; exit 1 ;;
+esac
+echo '{"format":{"duration":"59.960000"},"streams":[{"codec_type":"audio","codec_name":"aac"},{"codec_type":"video","codec_name":"h264"}]}'
+`), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := Run(context.Background(), script, []string{"-i", "recording.mkv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Duration() != 59960*time.Millisecond {
+		t.Errorf("wanted a duration of 59.96s, got %v", output.Duration())
+	}
+	if video := output.Video(); video == nil || video.CodecName != "h264" {
+		t.Errorf("wanted the h264 video stream, got %v", video)
+	}
+
+	_, err = Run(context.Background(), script, []string{"-i", "missing.mkv"})
+	if err == nil || err.Error() != "missing.mkv: No such file or directory" {
+		t.Errorf("wanted the error printed by ffprobe, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package files
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/logger"
+)
+
+// BufferDirName is the directory of the storage where the cameras with the events record write their recordings,
+// until they are promoted. Camera ids can't start with a dot.
+const BufferDirName = ".buffer"
+
+// DeleteReasonBuffer is the reason of the deletions of the buffered recordings that were not promoted
+const DeleteReasonBuffer = "not promoted from the event buffer"
+
+// BufferDir returns the directory where the recordings of the camera are buffered, with the same layout as CameraDir
+func BufferDir(camera *config.Camera) string {
+	return path.Join(config.Current().Storage.Path, BufferDirName, camera.Id)
+}
+
+// PromoteSegment moves a completed recording of the camera from its buffer to its directory, and indexes it
+func PromoteSegment(camera *config.Camera, name string, duration time.Duration) error {
+	promoted := path.Join(CameraDir(camera), name)
+
+	err := os.MkdirAll(path.Dir(promoted), 0700)
+	if err != nil {
+		return err
+	}
+
+	// The buffer is in the same storage, so the recording isn't copied
+	err = os.Rename(path.Join(BufferDir(camera), name), promoted)
+	if err != nil {
+		return err
+	}
+
+	return IndexRecording(camera, name, duration)
+}
+
+// PurgeBuffer deletes the buffered recordings of the camera started before the limit, they can't be promoted anymore
+func PurgeBuffer(camera *config.Camera, limit time.Time) {
+	p := &purger{
+		camera: camera,
+		root:   BufferDir(camera),
+		limit:  limit,
+		buffer: true,
+	}
+
+	err := filepath.WalkDir(p.root, p.purge())
+	if err != nil {
+		logger.Warn("Error deleting the buffered recordings of camera %v: %v", camera.Id, err)
+	}
+
+	p.removeEmptyDirs()
+
+	if len(p.deletions) > 0 {
+		logger.Trace("Deleted %d buffered recording(s) of camera %v", len(p.deletions), camera.Id)
+	}
+}
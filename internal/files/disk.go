@@ -0,0 +1,64 @@
+package files
+
+import (
+	"fmt"
+	"sync/atomic"
+	"vigilis/internal/config"
+	"vigilis/internal/logger"
+	"vigilis/internal/notify"
+
+	"golang.org/x/sys/unix"
+)
+
+// DiskUsage is the space of the filesystem where a path is stored
+type DiskUsage struct {
+	Total uint64
+	Free  uint64 // Available to unprivileged users
+}
+
+// GetDiskUsage returns the space of the filesystem where the path is stored
+func GetDiskUsage(path string) (DiskUsage, error) {
+	var stat unix.Statfs_t
+	err := unix.Statfs(path, &stat)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+
+	blockSize := uint64(stat.Bsize)
+	return DiskUsage{
+		Total: stat.Blocks * blockSize,
+		Free:  stat.Bavail * blockSize,
+	}, nil
+}
+
+// diskLow is set while the free space is under the notification threshold, to only notify once
+var diskLow atomic.Bool
+
+// checkFreeSpace notifies when the free space of the storage drops under the threshold
+func checkFreeSpace() {
+	current := config.Current()
+	notifications := current.Notifications
+	if notifications == nil || notifications.DiskFreeThreshold == "" {
+		return
+	}
+
+	storage := current.Storage
+	usage, err := GetDiskUsage(storage.Path)
+	if err != nil {
+		logger.Error("Error checking the free space of %v: %v", storage.Path, err)
+		return
+	}
+
+	threshold := notifications.FreeThreshold().Of(usage.Total)
+	if usage.Free >= threshold {
+		diskLow.Store(false)
+		return
+	}
+	if diskLow.Swap(true) {
+		return
+	}
+
+	logger.Warn("The storage is almost full, %d bytes free", usage.Free)
+	notify.Send(config.EventDiskAlmostFull, "",
+		fmt.Sprintf("%v has %d bytes free of %d, under the threshold of %d bytes", storage.Path, usage.Free, usage.Total, threshold))
+}
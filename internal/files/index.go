@@ -0,0 +1,296 @@
+package files
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/logger"
+	"vigilis/internal/util"
+
+	_ "modernc.org/sqlite"
+)
+
+// IndexSettleTime is how long a recording must not be written to before it's indexed when reconciling,
+// as it may still be recorded
+const IndexSettleTime = time.Minute
+
+const indexSchema = `
+CREATE TABLE IF NOT EXISTS segments (
+	camera_id  TEXT    NOT NULL,
+	name       TEXT    NOT NULL, -- Path relative to the camera directory
+	start_time INTEGER NOT NULL, -- Unix milliseconds
+	end_time   INTEGER NOT NULL, -- Unix milliseconds
+	duration   REAL    NOT NULL, -- Seconds
+	size       INTEGER NOT NULL,
+	codec      TEXT    NOT NULL,
+	PRIMARY KEY (camera_id, name)
+);
+CREATE INDEX IF NOT EXISTS segments_start ON segments (camera_id, start_time);
+`
+
+// index is the database of the completed recordings, nil when it's not open
+var index atomic.Pointer[sql.DB]
+
+// OpenIndex opens the recordings database, creating it if needed
+func OpenIndex() error {
+	indexPath := config.Current().Storage.IndexPath
+
+	err := os.MkdirAll(path.Dir(indexPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+indexPath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return err
+	}
+
+	// SQLite only supports one writer at a time
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(indexSchema)
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	index.Store(db)
+	logger.Trace("Recordings index opened at %v", indexPath)
+
+	return nil
+}
+
+// CloseIndex closes the recordings database
+func CloseIndex() error {
+	db := index.Swap(nil)
+	if db == nil {
+		return nil
+	}
+
+	return db.Close()
+}
+
+// IndexRecording adds a completed recording of the camera to the index.
+// The duration is probed from the file when zero.
+func IndexRecording(camera *config.Camera, name string, duration time.Duration) error {
+	db := index.Load()
+	if db == nil {
+		return nil
+	}
+
+	segment, err := FindSegment(camera, name)
+	if err != nil {
+		return err
+	}
+
+	probe, err := probeRecording(segment.Path)
+	if err != nil {
+		logger.Warn("Error probing recording %v: %v", segment.Path, err)
+	}
+	if duration == 0 {
+		duration = probe.Duration
+	}
+	if duration > 0 {
+		segment.End = segment.Start.Add(duration)
+	}
+	segment.Codec = probe.Codec
+
+	return indexSegment(db, segment)
+}
+
+func indexSegment(db *sql.DB, segment Segment) error {
+	_, err := db.Exec(
+		`INSERT OR REPLACE INTO segments (camera_id, name, start_time, end_time, duration, size, codec)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		segment.CameraId, segment.Name,
+		segment.Start.UnixMilli(), segment.End.UnixMilli(), segment.End.Sub(segment.Start).Seconds(),
+		segment.Size, segment.Codec,
+	)
+	return err
+}
+
+// unindexSegment removes a deleted recording from the index
+func unindexSegment(cameraId string, name string) {
+	db := index.Load()
+	if db == nil {
+		return
+	}
+
+	_, err := db.Exec(`DELETE FROM segments WHERE camera_id = ? AND name = ?`, cameraId, name)
+	if err != nil {
+		logger.Warn("Error removing recording %v of camera %v from the index: %v", name, cameraId, err)
+	}
+}
+
+// queryIndex returns the indexed segments of the camera that overlap the given range, sorted by start time
+func queryIndex(db *sql.DB, camera *config.Camera, from, to time.Time) ([]Segment, error) {
+	fromMilli, toMilli := int64(math.MinInt64), int64(math.MaxInt64)
+	if !from.IsZero() {
+		fromMilli = from.UnixMilli()
+	}
+	if !to.IsZero() {
+		toMilli = to.UnixMilli()
+	}
+
+	rows, err := db.Query(
+		`SELECT name, start_time, end_time, size, codec FROM segments
+		WHERE camera_id = ? AND end_time >= ? AND start_time <= ?
+		ORDER BY start_time`,
+		camera.Id, fromMilli, toMilli,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	segments := make([]Segment, 0)
+	for rows.Next() {
+		var (
+			segment    Segment
+			start, end int64
+		)
+
+		err := rows.Scan(&segment.Name, &start, &end, &segment.Size, &segment.Codec)
+		if err != nil {
+			return nil, err
+		}
+
+		segment.CameraId = camera.Id
+		segment.Path = path.Join(CameraDir(camera), segment.Name)
+		segment.Start = time.UnixMilli(start)
+		segment.End = time.UnixMilli(end)
+
+		segments = append(segments, segment)
+	}
+
+	return segments, rows.Err()
+}
+
+// listUnindexed returns the segments of the camera being recorded, which are indexed once completed
+func listUnindexed(db *sql.DB, camera *config.Camera) ([]Segment, error) {
+	var (
+		latestName  sql.NullString
+		latestStart sql.NullInt64
+	)
+	err := db.QueryRow(`SELECT name, start_time FROM segments WHERE camera_id = ? ORDER BY start_time DESC LIMIT 1`,
+		camera.Id).Scan(&latestName, &latestStart)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// Only the directory of the current recordings is checked, and the one of the previous segment
+	// as the current segment may have started in it, for example before midnight
+	storage := config.Current().Storage
+	pattern := storage.SegmentPattern()
+	now := time.Now()
+	segmentLength := time.Duration(camera.SegmentSeconds) * time.Second
+
+	dirs := []string{path.Dir(util.Strftime(pattern, now.Add(-2*segmentLength)))}
+	if dir := path.Dir(util.Strftime(pattern, now)); dir != dirs[0] {
+		dirs = append(dirs, dir)
+	}
+
+	var segments []Segment
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(path.Join(CameraDir(camera), dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// With a flat template this is the whole camera directory. The entries are sorted by name,
+		// so with most templates the ones up to the latest indexed are skipped without being parsed.
+		if latestName.Valid && path.Dir(latestName.String) == dir && storage.NamesSortByTime() {
+			first, _ := slices.BinarySearchFunc(entries, path.Base(latestName.String), func(entry os.DirEntry, name string) int {
+				return strings.Compare(entry.Name(), name)
+			})
+			entries = entries[first:]
+		}
+
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+
+			name := path.Join(dir, entry.Name())
+			start, err := ParseSegmentStart(name)
+			if err != nil || (latestStart.Valid && start.UnixMilli() <= latestStart.Int64) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			segments = append(segments, newSegment(camera, name, start, info))
+		}
+	}
+
+	return segments, nil
+}
+
+// ReconcileIndex indexes the recordings missing from the index and removes the ones missing from the disk
+func ReconcileIndex() {
+	db := index.Load()
+	if db == nil {
+		return
+	}
+
+	added, removed := 0, 0
+	for _, camera := range config.Current().Cameras {
+		onDisk, err := listSegmentsOnDisk(camera, time.Time{}, time.Time{})
+		if err != nil {
+			logger.Error("Error listing recordings of camera %v: %v", camera.Id, err)
+			continue
+		}
+
+		indexed, err := queryIndex(db, camera, time.Time{}, time.Time{})
+		if err != nil {
+			logger.Error("Error reading the index of camera %v: %v", camera.Id, err)
+			continue
+		}
+
+		names := make(map[string]bool, len(onDisk))
+		for _, segment := range onDisk {
+			names[segment.Name] = true
+		}
+
+		for _, segment := range indexed {
+			if names[segment.Name] {
+				delete(names, segment.Name)
+				continue
+			}
+
+			unindexSegment(camera.Id, segment.Name)
+			removed++
+		}
+
+		settled := time.Now().Add(-IndexSettleTime)
+		for _, segment := range onDisk {
+			if !names[segment.Name] || segment.End.After(settled) {
+				continue
+			}
+
+			err := IndexRecording(camera, segment.Name, 0)
+			if err != nil {
+				logger.Warn("Error indexing recording %v of camera %v: %v", segment.Name, camera.Id, err)
+				continue
+			}
+			added++
+		}
+	}
+
+	if added > 0 || removed > 0 {
+		logger.Info("Recordings index reconciled, %d recording(s) added and %d removed", added, removed)
+	}
+}
@@ -0,0 +1,95 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/ffprobe"
+)
+
+func TestReconcileIndex(t *testing.T) {
+	root := t.TempDir()
+
+	camera := &config.Camera{Id: "a", RetentionDays: 7}
+	config.Apply(&config.VigilisConfig{
+		Storage: &config.Storage{
+			Path:          root,
+			RetentionDays: 7,
+			PathTemplate:  config.DefaultPathTemplate,
+			IndexPath:     filepath.Join(root, config.DefaultIndexFile),
+		},
+		Cameras: []*config.Camera{camera},
+	})
+	ffprobe.Path = "false" // Probing fails, the modification time is used
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+		ffprobe.Path = ""
+	}()
+
+	err := OpenIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseIndex()
+
+	now := time.Now().Truncate(time.Second)
+	write := func(start time.Time, modTime time.Time) string {
+		name := start.Format("20060102-150405") + ".mkv"
+		path := filepath.Join(root, "a", name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+
+		return name
+	}
+
+	first := write(now.Add(-3*time.Hour), now.Add(-2*time.Hour))
+	second := write(now.Add(-2*time.Hour), now.Add(-time.Hour))
+	recording := write(now.Add(-time.Minute), now) // Still being written
+
+	ReconcileIndex()
+
+	indexed, err := queryIndex(index.Load(), camera, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 2 || indexed[0].Name != first || indexed[1].Name != second {
+		t.Fatalf("expected the completed recordings to be indexed, got %+v", indexed)
+	}
+	if !indexed[0].End.Equal(now.Add(-2 * time.Hour)) {
+		t.Errorf("expected the end to be the modification time, got %v", indexed[0].End)
+	}
+
+	// The recording being written is listed from the disk
+	segments, err := ListSegments(camera, now.Add(-90*time.Minute), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 || segments[0].Name != second || segments[1].Name != recording {
+		t.Errorf("expected the second and the current recordings, got %+v", segments)
+	}
+
+	// Recordings deleted outside of Vigilis are removed from the index
+	if err := os.Remove(filepath.Join(root, "a", first)); err != nil {
+		t.Fatal(err)
+	}
+
+	ReconcileIndex()
+
+	indexed, err = queryIndex(index.Load(), camera, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 1 || indexed[0].Name != second {
+		t.Errorf("expected only the second recording to be indexed, got %+v", indexed)
+	}
+}
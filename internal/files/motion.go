@@ -0,0 +1,140 @@
+package files
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/logger"
+)
+
+// MotionSuffix is appended to the path of a recording to get the file of its motion events.
+// The events are stored as JSON lines, in every recording they overlap.
+const MotionSuffix = ".motion.jsonl"
+
+// MotionEvent is a period with motion on a camera
+type MotionEvent struct {
+	CameraId string    `json:"camera_id"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`  // Last frame with motion
+	Peak     float64   `json:"peak"` // Highest percentage of the frame that changed
+}
+
+// RecordMotion stores the motion event alongside the recordings it overlaps
+func RecordMotion(camera *config.Camera, event MotionEvent) error {
+	segments, err := ListSegments(camera, event.Start, event.End)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return errors.New("no recording of the motion")
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	var errs []error
+	for _, segment := range segments {
+		errs = append(errs, appendFile(segment.Path+MotionSuffix, line))
+	}
+
+	return errors.Join(errs...)
+}
+
+func appendFile(filePath string, data []byte) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+
+	return errors.Join(err, file.Close())
+}
+
+// ListMotion returns the motion events of the camera that overlap the given range, sorted by start time.
+// Zero times leave the range open.
+func ListMotion(camera *config.Camera, from, to time.Time) ([]MotionEvent, error) {
+	segments, err := ListSegments(camera, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]MotionEvent, 0)
+	for _, segment := range segments {
+		segmentEvents, err := readMotion(segment.Path + MotionSuffix)
+		if err != nil {
+			logger.Warn("Error reading the motion events of %v: %v", segment.Path, err)
+			continue
+		}
+
+		for _, event := range segmentEvents {
+			if !from.IsZero() && event.End.Before(from) || !to.IsZero() && event.Start.After(to) {
+				continue
+			}
+
+			// Events spanning several recordings are stored in each of them
+			duplicate := slices.ContainsFunc(events, func(other MotionEvent) bool {
+				return other.Start.Equal(event.Start)
+			})
+			if !duplicate {
+				events = append(events, event)
+			}
+		}
+	}
+
+	slices.SortFunc(events, func(a, b MotionEvent) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	return events, nil
+}
+
+// readMotion reads the motion events of a recording, none if it has no motion
+func readMotion(filePath string) ([]MotionEvent, error) {
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []MotionEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event MotionEvent
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			// A line may have been cut by a crash
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+}
+
+// removeRecording deletes a recording and its motion events
+func removeRecording(filePath string) error {
+	err := os.Remove(filePath)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filePath + MotionSuffix)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Warn("Error deleting the motion events of %v: %v", filePath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"time"
+	"vigilis/internal/ffprobe"
+)
+
+type recordingProbe struct {
+	Duration time.Duration
+	Codec    string // Video codec
+}
+
+// probeRecording reads the duration and video codec of a recording with ffprobe.
+// Nothing is probed when ffprobe was not found.
+func probeRecording(recordingPath string) (recordingProbe, error) {
+	var probe recordingProbe
+	if ffprobe.Path == "" {
+		return probe, nil
+	}
+
+	path, args := ffprobe.Command(nil, recordingPath)
+	output, err := ffprobe.Run(context.Background(), path, args)
+	if err != nil {
+		return probe, err
+	}
+
+	probe.Duration = output.Duration()
+	if video := output.Video(); video != nil {
+		probe.Codec = video.CodecName
+	}
+
+	if probe.Duration == 0 && probe.Codec == "" {
+		return probe, errors.New("no duration or video stream found")
+	}
+
+	return probe, nil
+}
@@ -1,68 +1,300 @@
 package files
 
 import (
+	"errors"
+	"fmt"
 	"io/fs"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 	"vigilis/internal/config"
 	"vigilis/internal/logger"
+	"vigilis/internal/notify"
 )
 
+// Deletion is a recording deleted by a purge, or that would be deleted by a dry run
+type Deletion struct {
+	CameraId string `json:"camera_id"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Reason   string `json:"reason"`
+}
+
 type purger struct {
-	limit time.Duration
-	count int
+	camera *config.Camera
+	root   string    // Directory of the camera, or of its buffer
+	limit  time.Time // Recordings started before this are deleted
+	dryRun bool
+	buffer bool // Buffered recordings of the events record, which are not indexed
+
+	deletions []Deletion
+	dirs      []string // Directories where recordings were deleted, to be removed if empty
 }
 
+// DeleteReasonRetention is the reason of the deletions of the recordings older than the retention days
+const DeleteReasonRetention = "recorded more than %d day(s) ago"
+
+// PurgeStats are the totals of the purges since vigilis started
+type PurgeStats struct {
+	Runs         int
+	LastRun      time.Time
+	DeletedFiles map[string]int   // Deleted recordings of each camera
+	DeletedBytes map[string]int64 // Size of the deleted recordings of each camera
+}
+
+var (
+	purgeStatsMu sync.Mutex
+	purgeStats   = PurgeStats{DeletedFiles: make(map[string]int), DeletedBytes: make(map[string]int64)}
+)
+
+// maintenance prevents the recordings from being purged by overlapping runs
+var maintenance sync.Mutex
+
 func DeleteOldRecordings() {
+	Purge(false)
+}
+
+// Purge deletes the recordings older than the retention of their camera, and the oldest ones
+// while over the quotas. Nothing is deleted on a dry run, only the deletions are returned.
+func Purge(dryRun bool) []Deletion {
+	if !maintenance.TryLock() {
+		logger.Warn("Old recordings are still being deleted, skipping")
+		return nil
+	}
+	defer maintenance.Unlock()
+
+	// Purge and evict from an up to date index
+	if !dryRun {
+		ReconcileIndex()
+	}
+
 	logger.Info("Deleting old recordings...")
 
-	path := config.Vigilis.Storage.Path
-	p := &purger{
-		limit: config.Vigilis.Storage.RetentionDaysDuration(),
+	current := config.Current()
+
+	var deletions []Deletion
+	for _, camera := range current.Cameras {
+		deletions = append(deletions, purgeCamera(camera, dryRun)...)
+
+		// The buffer is left over when the events record was disabled, the recorders purge it otherwise
+		if !dryRun && !camera.EventRecordingEnabled() {
+			PurgeBuffer(camera, time.Now())
+		}
 	}
 
-	// Walk the recordings directory and try to purge files
-	err := filepath.WalkDir(path, p.purge())
-	if err != nil {
-		logger.Error("Error deleting old recordings: %v", err)
-		return
+	// The recordings of the cameras removed from the config are kept for the storage retention,
+	// their buffers can't be promoted anymore
+	for _, camera := range unknownCameras(current.Storage.Path, current.Cameras) {
+		camera.RetentionDays = current.Storage.RetentionDays
+		deletions = append(deletions, purgeCamera(camera, dryRun)...)
+	}
+	if !dryRun {
+		for _, camera := range unknownCameras(path.Join(current.Storage.Path, BufferDirName), current.Cameras) {
+			PurgeBuffer(camera, time.Now())
+		}
 	}
 
-	if p.count > 0 {
-		logger.Info("Deleted %d recording(s)", p.count)
+	if len(deletions) > 0 {
+		logger.Info("Deleted %d recording(s)", len(deletions))
 	} else {
 		logger.Info("No recordings were deleted")
 	}
+
+	// Delete more recordings if they still take too much space
+	deletions = append(deletions, enforceQuota(dryRun, deletions)...)
+
+	if !dryRun {
+		recordPurge(deletions)
+		checkFreeSpace()
+	}
+
+	return deletions
 }
 
-func (p *purger) purge() func(path string, entry fs.DirEntry, _ error) error {
-	return func(path string, entry fs.DirEntry, _ error) error {
+// purgeCamera deletes the recordings of the camera older than its retention
+func purgeCamera(camera *config.Camera, dryRun bool) []Deletion {
+	p := &purger{
+		camera: camera,
+		root:   CameraDir(camera),
+		limit:  time.Now().Add(-camera.RetentionDaysDuration()),
+		dryRun: dryRun,
+	}
+
+	// Walk the recordings directory of the camera and try to purge files
+	err := filepath.WalkDir(p.root, p.purge())
+	if err != nil {
+		logger.Error("Error deleting old recordings of camera %v: %v", camera.Id, err)
+		notify.Send(config.EventPurgeError, camera.Id, fmt.Sprintf("Error deleting old recordings: %v", err))
+	}
+
+	if !dryRun {
+		p.removeEmptyDirs()
+	}
+
+	return p.deletions
+}
+
+// unknownCameras returns the cameras that have a directory in dir but are not in the config.
+// Files, like the index, and hidden directories, like the buffer, are skipped.
+func unknownCameras(dir string, cameras []*config.Camera) []*config.Camera {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Warn("Error listing the directories of %v: %v", dir, err)
+		}
+		return nil
+	}
+
+	var unknown []*config.Camera
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		configured := slices.ContainsFunc(cameras, func(camera *config.Camera) bool {
+			return camera.Id == entry.Name()
+		})
+		if !configured {
+			unknown = append(unknown, &config.Camera{Id: entry.Name()})
+		}
+	}
+
+	return unknown
+}
+
+func recordPurge(deletions []Deletion) {
+	purgeStatsMu.Lock()
+	defer purgeStatsMu.Unlock()
+
+	purgeStats.Runs++
+	purgeStats.LastRun = time.Now()
+	for _, deletion := range deletions {
+		purgeStats.DeletedFiles[deletion.CameraId]++
+		purgeStats.DeletedBytes[deletion.CameraId] += deletion.Size
+	}
+}
+
+// GetPurgeStats returns a copy of the totals of the purges
+func GetPurgeStats() PurgeStats {
+	purgeStatsMu.Lock()
+	defer purgeStatsMu.Unlock()
+
+	stats := purgeStats
+	stats.DeletedFiles = maps.Clone(purgeStats.DeletedFiles)
+	stats.DeletedBytes = maps.Clone(purgeStats.DeletedBytes)
+
+	return stats
+}
+
+func (p *purger) purge() fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Nothing was recorded yet
+			if path == p.root && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+
+			// Skip what can't be read and keep going
+			logger.Warn("Error reading %v for possible deletion: %v", path, err)
+			if entry != nil && entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
 		// Don't try to purge directories
 		if entry.IsDir() {
 			return nil
 		}
 
-		// Get the file info
-		info, err := entry.Info()
+		// Only purge recordings, using the start time from their name
+		rel, err := filepath.Rel(p.root, path)
 		if err != nil {
-			logger.Error("Error analysing recording for possible deletion: %v", err)
 			return nil
 		}
 
-		// Check if the age of the file is past the retention limit
-		age := time.Since(info.ModTime())
-		if age > p.limit {
-			err := os.Remove(path)
-			if err != nil {
-				logger.Warn("Error deleting recording %v: %v", path, err)
-				return nil
+		name := filepath.ToSlash(rel)
+
+		// Motion events are deleted with their recording, unless it was deleted outside of vigilis
+		if recording, found := strings.CutSuffix(path, MotionSuffix); found {
+			_, err := os.Stat(recording)
+			if errors.Is(err, fs.ErrNotExist) && !p.dryRun && os.Remove(path) == nil {
+				p.dirs = append(p.dirs, filepath.Dir(path))
+				logger.Trace("Motion events %v of a deleted recording removed", path)
 			}
+			return nil
+		}
+
+		start, err := ParseSegmentStart(name)
+		if err != nil {
+			logger.Trace("Skipping %v, not a recording", path)
+			return nil
+		}
 
-			p.count++
-			logger.Trace("Recording %v deleted", path)
+		if !start.Before(p.limit) {
+			return nil
 		}
 
+		info, err := entry.Info()
+		if err != nil {
+			// The file may have been deleted in the meantime
+			return nil
+		}
+
+		deletion := Deletion{
+			CameraId: p.camera.Id,
+			Path:     path,
+			Size:     info.Size(),
+			Reason:   fmt.Sprintf(DeleteReasonRetention, p.camera.RetentionDays),
+		}
+		if p.buffer {
+			deletion.Reason = DeleteReasonBuffer
+		}
+		if p.dryRun {
+			p.deletions = append(p.deletions, deletion)
+			return nil
+		}
+
+		err = removeRecording(path)
+		if err != nil {
+			logger.Warn("Error deleting recording %v: %v", path, err)
+			return nil
+		}
+
+		if !p.buffer {
+			unindexSegment(p.camera.Id, name)
+		}
+
+		p.deletions = append(p.deletions, deletion)
+		p.dirs = append(p.dirs, filepath.Dir(path))
+		logger.Trace("Recording %v deleted", path)
+
 		return nil
 	}
 }
+
+// removeEmptyDirs removes the directories left empty by the purge, up to the camera directory.
+// Directories that were already empty are kept, as they may have been created for upcoming recordings.
+func (p *purger) removeEmptyDirs() {
+	// Deepest directories first
+	slices.Sort(p.dirs)
+	p.dirs = slices.Compact(p.dirs)
+	slices.Reverse(p.dirs)
+
+	for _, dir := range p.dirs {
+		for dir != p.root && dir != "." && dir != string(filepath.Separator) {
+			// Fails when the directory is not empty
+			if os.Remove(dir) != nil {
+				break
+			}
+
+			logger.Trace("Empty directory %v removed", dir)
+			dir = filepath.Dir(dir)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+)
+
+func TestDeleteOldRecordings(t *testing.T) {
+	root := t.TempDir()
+
+	config.Apply(&config.VigilisConfig{
+		Storage: &config.Storage{Path: root, RetentionDays: 7, PathTemplate: config.DefaultPathTemplate},
+		Cameras: []*config.Camera{
+			{Id: "a", RetentionDays: 7},
+			{Id: "b", RetentionDays: 30},
+		},
+	})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+	}()
+
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour)
+	files := []struct {
+		Path    string
+		ModTime time.Time
+		Deleted bool
+	}{
+		// Old recordings of a camera with the default retention
+		{Path: "a/" + old.Format("20060102-150405") + ".mkv", ModTime: now, Deleted: true},
+		// Motion events are deleted with their recording, or when their recording is missing
+		{Path: "a/" + old.Format("20060102-150405") + ".mkv" + MotionSuffix, ModTime: now, Deleted: true},
+		{Path: "a/" + now.Format("20060102-150405") + ".mkv" + MotionSuffix, ModTime: old},
+		{Path: "a/" + now.Add(-time.Hour).Format("20060102-150405") + ".mkv" + MotionSuffix, ModTime: now, Deleted: true},
+		// The name is used instead of the modification time
+		{Path: "a/" + now.Format("20060102-150405") + ".mkv", ModTime: old},
+		// Files that are not recordings are never deleted
+		{Path: "a/notes.txt", ModTime: old},
+		{Path: "a/" + old.Format("20060102") + ".mkv", ModTime: old},
+		// Camera with a longer retention
+		{Path: "b/" + old.Format("20060102-150405") + ".mkv", ModTime: old},
+		// Cameras removed from the config use the storage retention, and their buffer is deleted
+		{Path: "c/" + old.Format("20060102-150405") + ".mkv", ModTime: old, Deleted: true},
+		{Path: "c/" + now.Format("20060102-150405") + ".mkv", ModTime: old},
+		{Path: BufferDirName + "/c/" + now.Format("20060102-150405") + ".mkv", ModTime: now, Deleted: true},
+		// Files and hidden directories of the storage are never touched
+		{Path: old.Format("20060102-150405") + ".mkv", ModTime: old},
+		{Path: config.DefaultIndexFile, ModTime: old},
+		{Path: ".hidden/" + old.Format("20060102-150405") + ".mkv", ModTime: old},
+	}
+
+	for _, file := range files {
+		path := filepath.Join(root, file.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, file.ModTime, file.ModTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	DeleteOldRecordings()
+
+	for _, file := range files {
+		_, err := os.Stat(filepath.Join(root, file.Path))
+		if deleted := os.IsNotExist(err); deleted != file.Deleted {
+			t.Errorf("%v: wanted deleted %v, got %v", file.Path, file.Deleted, deleted)
+		}
+	}
+}
+
+func TestDeleteOldRecordingsPartitioned(t *testing.T) {
+	root := t.TempDir()
+
+	config.Apply(&config.VigilisConfig{
+		Storage: &config.Storage{Path: root, RetentionDays: 7, PathTemplate: "{camera}/%Y/%m/%d/%H%M%S.mkv"},
+		Cameras: []*config.Camera{{Id: "a", RetentionDays: 7}},
+	})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+	}()
+
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour)
+	oldRecording := filepath.Join(root, "a", old.Format("2006/01/02/150405")+".mkv")
+	newRecording := filepath.Join(root, "a", now.Format("2006/01/02/150405")+".mkv")
+	upcomingDir := filepath.Join(root, "a", now.Add(24*time.Hour).Format("2006/01/02"))
+
+	for _, path := range []string{oldRecording, newRecording} {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(upcomingDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	DeleteOldRecordings()
+
+	if _, err := os.Stat(oldRecording); !os.IsNotExist(err) {
+		t.Error("old recording was not deleted")
+	}
+	if _, err := os.Stat(filepath.Dir(oldRecording)); !os.IsNotExist(err) {
+		t.Error("empty day directory was not removed")
+	}
+	if _, err := os.Stat(newRecording); err != nil {
+		t.Errorf("new recording was deleted: %v", err)
+	}
+	if _, err := os.Stat(upcomingDir); err != nil {
+		t.Errorf("upcoming day directory was removed: %v", err)
+	}
+}
+
+func TestPurgeCameraPolicies(t *testing.T) {
+	root := t.TempDir()
+
+	c, err := config.Load([]byte(`---
+storage:
+  path: ` + root + `
+  retention_days: 7
+cameras:
+  - id: short
+    name: Short
+    stream_url: rtsp://short
+    retention_days: 3
+  - id: default
+    name: Default
+    stream_url: rtsp://default
+  - id: long
+    name: Long
+    stream_url: rtsp://long
+    retention_days: 30
+  - id: small
+    name: Small
+    stream_url: rtsp://small
+    max_bytes: 200B
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Apply(c)
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+	}()
+
+	now := time.Now()
+	name := func(age time.Duration) string {
+		return now.Add(-age).Format("20060102-150405") + ".mkv"
+	}
+	day := 24 * time.Hour
+
+	files := []struct {
+		Path   string
+		Reason string // Empty when the recording is kept
+	}{
+		{Path: "short/" + name(5*day), Reason: "recorded more than 3 day(s) ago"},
+		{Path: "short/" + name(day)},
+		{Path: "default/" + name(10*day), Reason: "recorded more than 7 day(s) ago"},
+		{Path: "default/" + name(5*day)},
+		{Path: "long/" + name(40*day), Reason: "recorded more than 30 day(s) ago"},
+		{Path: "long/" + name(10*day)},
+		// Only the oldest recordings of the camera over its quota are evicted
+		{Path: "small/" + name(4*time.Hour), Reason: EvictReasonCameraMaxBytes},
+		{Path: "small/" + name(3*time.Hour), Reason: EvictReasonCameraMaxBytes},
+		{Path: "small/" + name(2*time.Hour)},
+		{Path: "small/" + name(time.Hour)},
+	}
+
+	for _, file := range files {
+		path := filepath.Join(root, file.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, 100), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reasons := make(map[string]string)
+	for _, deletion := range Purge(false) {
+		reasons[deletion.Path] = deletion.Reason
+	}
+
+	for _, file := range files {
+		path := filepath.Join(root, file.Path)
+		if reasons[path] != file.Reason {
+			t.Errorf("%v: wanted deletion reason %q, got %q", file.Path, file.Reason, reasons[path])
+		}
+
+		_, err := os.Stat(path)
+		if deleted := os.IsNotExist(err); deleted != (file.Reason != "") {
+			t.Errorf("%v: wanted deleted %v, got %v", file.Path, file.Reason != "", deleted)
+		}
+	}
+}
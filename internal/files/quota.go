@@ -0,0 +1,188 @@
+package files
+
+import (
+	"fmt"
+	"slices"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/logger"
+	"vigilis/internal/notify"
+)
+
+const (
+	EvictReasonMaxBytes       = "recordings are over max_bytes"
+	EvictReasonMinFree        = "free space is under min_free_bytes"
+	EvictReasonCameraMaxBytes = "camera recordings are over its max_bytes"
+)
+
+type evicter struct {
+	dryRun  bool
+	deleted map[string]bool // Recordings already deleted by the dry run
+
+	used       uint64            // Size of the recordings of all cameras
+	cameraUsed map[string]uint64 // Size of the recordings of each camera
+	free       uint64
+
+	deletions []Deletion
+	bytes     uint64
+}
+
+// enforceQuota deletes the oldest recordings until each camera is under its own quota
+// and all the recordings are under the storage quota. Nothing is deleted on a dry run.
+func enforceQuota(dryRun bool, deleted []Deletion) []Deletion {
+	current := config.Current()
+	storage := current.Storage
+
+	maxBytes, minFree := storage.Quota()
+	hasCameraQuota := slices.ContainsFunc(current.Cameras, func(camera *config.Camera) bool {
+		return !camera.Quota().IsZero()
+	})
+	if maxBytes.IsZero() && minFree.IsZero() && !hasCameraQuota {
+		return nil
+	}
+
+	usage, err := GetDiskUsage(storage.Path)
+	if err != nil {
+		logger.Error("Error checking the free space of %v: %v", storage.Path, err)
+		notify.Send(config.EventPurgeError, "", fmt.Sprintf("Error checking the free space of %v: %v", storage.Path, err))
+		return nil
+	}
+
+	e := &evicter{
+		dryRun:     dryRun,
+		deleted:    make(map[string]bool, len(deleted)),
+		cameraUsed: make(map[string]uint64),
+		free:       usage.Free,
+	}
+
+	for _, deletion := range deleted {
+		e.deleted[deletion.Path] = true
+		if dryRun {
+			e.free += uint64(deletion.Size)
+		}
+	}
+
+	// Each camera is limited by its own quota first
+	var segments []Segment
+	for _, camera := range current.Cameras {
+		cameraSegments := e.listEvictable(camera, true)
+
+		cameraMaxBytes := camera.Quota().Of(usage.Total)
+		if cameraMaxBytes > 0 {
+			cameraSegments = e.evict(cameraSegments, func() string {
+				if e.cameraUsed[camera.Id] > cameraMaxBytes {
+					return EvictReasonCameraMaxBytes
+				}
+				return ""
+			})
+		}
+
+		segments = append(segments, cameraSegments...)
+	}
+
+	// The recordings of the cameras removed from the config only count for the storage quota
+	for _, camera := range unknownCameras(storage.Path, current.Cameras) {
+		segments = append(segments, e.listEvictable(camera, false)...)
+	}
+
+	// Then the oldest recordings of all cameras are evicted for the storage quota
+	slices.SortFunc(segments, func(a, b Segment) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	storageMaxBytes := maxBytes.Of(usage.Total)
+	storageMinFree := minFree.Of(usage.Total)
+	storageReason := func() string {
+		if storageMaxBytes > 0 && e.used > storageMaxBytes {
+			return EvictReasonMaxBytes
+		}
+		if storageMinFree > 0 && e.free < storageMinFree {
+			return EvictReasonMinFree
+		}
+		return ""
+	}
+
+	e.evict(segments, storageReason)
+	if reason := storageReason(); reason != "" {
+		logger.Warn("Unable to evict enough recordings, %v", reason)
+		if !dryRun {
+			notify.Send(config.EventPurgeError, "", "Unable to evict enough recordings, "+reason)
+		}
+	}
+
+	if len(e.deletions) > 0 {
+		logger.Info("Evicted %d recording(s), %d bytes", len(e.deletions), e.bytes)
+	}
+
+	return e.deletions
+}
+
+// listEvictable returns the segments of the camera, oldest first, except the one being recorded
+// when the camera is recording
+func (e *evicter) listEvictable(camera *config.Camera, recording bool) []Segment {
+	segments, err := ListSegments(camera, time.Time{}, time.Time{})
+	if err != nil {
+		logger.Error("Error listing recordings of camera %v: %v", camera.Id, err)
+		notify.Send(config.EventPurgeError, camera.Id, fmt.Sprintf("Error listing recordings: %v", err))
+		return nil
+	}
+
+	segments = slices.DeleteFunc(segments, func(segment Segment) bool {
+		return e.deleted[segment.Path]
+	})
+
+	for _, segment := range segments {
+		e.used += uint64(segment.Size)
+		e.cameraUsed[camera.Id] += uint64(segment.Size)
+	}
+
+	// The latest segment is still being written
+	if recording && len(segments) > 0 {
+		segments = segments[:len(segments)-1]
+	}
+
+	return segments
+}
+
+// evict deletes the oldest segments while there is a reason to, returning the segments left,
+// including the ones that couldn't be deleted
+func (e *evicter) evict(segments []Segment, reason func() string) []Segment {
+	var left []Segment
+	for i, segment := range segments {
+		why := reason()
+		if why == "" {
+			return append(left, segments[i:]...)
+		}
+
+		if !e.dryRun {
+			err := removeRecording(segment.Path)
+			if err != nil {
+				logger.Warn("Error evicting recording %v: %v", segment.Path, err)
+				left = append(left, segment)
+				continue
+			}
+
+			unindexSegment(segment.CameraId, segment.Name)
+		}
+
+		size := uint64(segment.Size)
+		e.used -= size
+		e.cameraUsed[segment.CameraId] -= size
+		e.free += size
+		e.bytes += size
+		e.deletions = append(e.deletions, Deletion{
+			CameraId: segment.CameraId,
+			Path:     segment.Path,
+			Size:     segment.Size,
+			Reason:   why,
+		})
+
+		if e.dryRun {
+			continue
+		}
+
+		logger.Info("Evicted recording %v (%d bytes) from %v, %v", segment.Name, segment.Size, segment.CameraId, why)
+	}
+
+	return left
+}
@@ -0,0 +1,154 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+)
+
+func TestEnforceQuota(t *testing.T) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	name := func(minute int) string {
+		return start.Add(time.Duration(minute)*time.Minute).Format("20060102-150405") + ".mkv"
+	}
+
+	// 100 bytes each, the cameras recorded in turns
+	recordings := []string{
+		"a/" + name(1), "b/" + name(2), "a/" + name(3), "b/" + name(4),
+		"a/" + name(5), "b/" + name(6), "a/" + name(7), "b/" + name(8),
+	}
+
+	cases := []struct {
+		Name            string
+		StorageMaxBytes string
+		CameraMaxBytes  map[string]string
+		Removed         string // Camera removed from the config
+		DryRun          bool
+		Deleted         []string // In the order of the deletions
+	}{
+		{
+			Name:            "under-quota",
+			StorageMaxBytes: "800B",
+		},
+		{
+			Name:            "storage-oldest-of-all-cameras",
+			StorageMaxBytes: "500B",
+			Deleted:         []string{"a/" + name(1), "b/" + name(2), "a/" + name(3)},
+		},
+		{
+			Name:           "camera-only-its-recordings",
+			CameraMaxBytes: map[string]string{"b": "200B"},
+			Deleted:        []string{"b/" + name(2), "b/" + name(4)},
+		},
+		{
+			Name:            "camera-before-storage",
+			StorageMaxBytes: "500B",
+			CameraMaxBytes:  map[string]string{"b": "200B"},
+			Deleted:         []string{"b/" + name(2), "b/" + name(4), "a/" + name(1)},
+		},
+		{
+			Name:            "latest-recordings-kept",
+			StorageMaxBytes: "100B",
+			Deleted: []string{
+				"a/" + name(1), "b/" + name(2), "a/" + name(3),
+				"b/" + name(4), "a/" + name(5), "b/" + name(6),
+			},
+		},
+		{
+			Name:            "removed-camera",
+			StorageMaxBytes: "100B",
+			Removed:         "b",
+			Deleted: []string{
+				"a/" + name(1), "b/" + name(2), "a/" + name(3), "b/" + name(4),
+				"a/" + name(5), "b/" + name(6), "b/" + name(8),
+			},
+		},
+		{
+			Name:            "dry-run",
+			StorageMaxBytes: "500B",
+			CameraMaxBytes:  map[string]string{"b": "200B"},
+			DryRun:          true,
+			Deleted:         []string{"b/" + name(2), "b/" + name(4), "a/" + name(1)},
+		},
+	}
+
+	for _, caseData := range cases {
+		t.Run(caseData.Name, func(t *testing.T) {
+			root := t.TempDir()
+
+			cameras := []*config.Camera{{Id: "a"}, {Id: "b"}}
+			cameras = slices.DeleteFunc(cameras, func(camera *config.Camera) bool {
+				return camera.Id == caseData.Removed
+			})
+			for _, camera := range cameras {
+				camera.MaxBytes = caseData.CameraMaxBytes[camera.Id]
+			}
+			config.Apply(&config.VigilisConfig{
+				Storage: &config.Storage{
+					Path:          root,
+					RetentionDays: 7,
+					PathTemplate:  config.DefaultPathTemplate,
+					MaxBytes:      caseData.StorageMaxBytes,
+				},
+				Cameras: cameras,
+			})
+			defer func() {
+				config.Apply(&config.VigilisConfig{})
+			}()
+
+			for _, recording := range recordings {
+				path := filepath.Join(root, recording)
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, make([]byte, 100), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var deleted []string
+			for _, deletion := range enforceQuota(caseData.DryRun, nil) {
+				relative, _ := filepath.Rel(root, deletion.Path)
+				deleted = append(deleted, relative)
+			}
+			if !slices.Equal(deleted, caseData.Deleted) {
+				t.Errorf("wanted deletions %v, got %v", caseData.Deleted, deleted)
+			}
+
+			for _, recording := range recordings {
+				_, err := os.Stat(filepath.Join(root, recording))
+				wanted := !caseData.DryRun && slices.Contains(caseData.Deleted, recording)
+				if deleted := os.IsNotExist(err); deleted != wanted {
+					t.Errorf("%v: wanted deleted %v, got %v", recording, wanted, deleted)
+				}
+			}
+		})
+	}
+}
+
+func TestEvictKeepsFailedRemovals(t *testing.T) {
+	root := t.TempDir()
+	missing := Segment{CameraId: "a", Name: "missing.mkv", Path: filepath.Join(root, "missing.mkv"), Size: 100}
+	present := Segment{CameraId: "a", Name: "present.mkv", Path: filepath.Join(root, "present.mkv"), Size: 100}
+	if err := os.WriteFile(present.Path, make([]byte, 100), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &evicter{used: 200, cameraUsed: map[string]uint64{"a": 200}}
+	left := e.evict([]Segment{missing, present}, func() string {
+		if e.used > 100 {
+			return EvictReasonMaxBytes
+		}
+		return ""
+	})
+
+	if len(left) != 1 || left[0].Path != missing.Path {
+		t.Errorf("wanted the recording that couldn't be deleted to be left, got %v", left)
+	}
+	if len(e.deletions) != 1 || e.deletions[0].Path != present.Path {
+		t.Errorf("wanted only %v to be deleted, got %v", present.Path, e.deletions)
+	}
+}
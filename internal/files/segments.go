@@ -0,0 +1,162 @@
+package files
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/logger"
+	"vigilis/internal/util"
+)
+
+// Segment is a recording file written by a recorder
+type Segment struct {
+	CameraId string    `json:"camera_id"`
+	Name     string    `json:"name"` // Path relative to the camera directory
+	Path     string    `json:"-"`
+	Start    time.Time `json:"start"` // Parsed from the name
+	End      time.Time `json:"end"`   // Last time the file was written to, until indexed
+	Size     int64     `json:"size"`
+	Codec    string    `json:"codec,omitempty"` // Video codec, only known once indexed
+}
+
+// CameraDir returns the directory where the recordings of the camera are stored
+func CameraDir(camera *config.Camera) string {
+	return path.Join(config.Current().Storage.Path, camera.Id)
+}
+
+// ParseSegmentStart returns the start time of a segment from its path relative to the camera directory
+func ParseSegmentStart(name string) (time.Time, error) {
+	// ffmpeg uses the local time when naming the segments
+	return util.ParseStrftime(config.Current().Storage.SegmentPattern(), name, time.Local)
+}
+
+// ListSegments returns the segments of the camera that overlap the given range, sorted by start time.
+// Zero times leave the range open.
+func ListSegments(camera *config.Camera, from, to time.Time) ([]Segment, error) {
+	db := index.Load()
+	if db == nil {
+		return listSegmentsOnDisk(camera, from, to)
+	}
+
+	segments, err := queryIndex(db, camera, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// The segments being recorded are not indexed yet
+	unindexed, err := listUnindexed(db, camera)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, segment := range unindexed {
+		if segment.overlaps(from, to) {
+			segments = append(segments, segment)
+		}
+	}
+
+	sortSegments(segments)
+
+	return segments, nil
+}
+
+// listSegmentsOnDisk is ListSegments walking the camera directory instead of using the index
+func listSegmentsOnDisk(camera *config.Camera, from, to time.Time) ([]Segment, error) {
+	dir := CameraDir(camera)
+	segments := make([]Segment, 0)
+
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Nothing was recorded yet
+			if filePath == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			if filePath == dir {
+				return err
+			}
+
+			logger.Warn("Error listing %v: %v", filePath, err)
+			return nil
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		// Skip files that are not recordings
+		name, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return nil
+		}
+		name = filepath.ToSlash(name)
+
+		start, err := ParseSegmentStart(name)
+		if err != nil {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// The file may have been purged in the meantime
+			return nil
+		}
+
+		segment := newSegment(camera, name, start, info)
+		if !segment.overlaps(from, to) {
+			return nil
+		}
+
+		segments = append(segments, segment)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortSegments(segments)
+
+	return segments, nil
+}
+
+// FindSegment returns the segment of the camera with the given name
+func FindSegment(camera *config.Camera, name string) (Segment, error) {
+	// Only accept recording names, so paths can't escape the camera directory
+	start, err := ParseSegmentStart(name)
+	if err != nil {
+		return Segment{}, err
+	}
+
+	info, err := os.Stat(path.Join(CameraDir(camera), name))
+	if err != nil {
+		return Segment{}, err
+	}
+
+	return newSegment(camera, name, start, info), nil
+}
+
+func newSegment(camera *config.Camera, name string, start time.Time, info fs.FileInfo) Segment {
+	return Segment{
+		CameraId: camera.Id,
+		Name:     name,
+		Path:     path.Join(CameraDir(camera), name),
+		Start:    start,
+		End:      info.ModTime(),
+		Size:     info.Size(),
+	}
+}
+
+// overlaps checks if the segment overlaps the given range, zero times leave the range open
+func (s Segment) overlaps(from, to time.Time) bool {
+	return (from.IsZero() || !s.End.Before(from)) && (to.IsZero() || !s.Start.After(to))
+}
+
+func sortSegments(segments []Segment) {
+	slices.SortFunc(segments, func(a, b Segment) int {
+		return a.Start.Compare(b.Start)
+	})
+}
@@ -26,6 +26,21 @@ func Setup(debug bool) {
 		logLevel = log.LevelTrace
 	}
 
+	setup(logLevel)
+}
+
+// SetupQuiet sets up the logger to only log warnings and errors, unless debugging,
+// so it doesn't get mixed with the output of the commands
+func SetupQuiet(debug bool) {
+	logLevel := log.LevelWarn
+	if debug {
+		logLevel = log.LevelTrace
+	}
+
+	setup(logLevel)
+}
+
+func setup(logLevel log.Level) {
 	// Create the logger
 	err := log.NewConsole(log.ConsoleConfig{Level: logLevel})
 	if err != nil {
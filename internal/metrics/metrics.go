@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/files"
+	"vigilis/internal/logger"
+	"vigilis/internal/recorders"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "vigilis"
+
+var (
+	recorderUp = prometheus.NewDesc(namespace+"_recorder_up",
+		"Whether the camera is being recorded.", []string{"camera"}, nil)
+	recorderRestarts = prometheus.NewDesc(namespace+"_recorder_restarts_total",
+		"Restarts of the recording process.", []string{"camera"}, nil)
+	recorderUptime = prometheus.NewDesc(namespace+"_recorder_process_uptime_seconds",
+		"How long the current recording process has been running.", []string{"camera"}, nil)
+	recorderBytes = prometheus.NewDesc(namespace+"_recorder_bytes_written_total",
+		"Size of the completed segments.", []string{"camera"}, nil)
+	recorderSegments = prometheus.NewDesc(namespace+"_recorder_segments_completed_total",
+		"Completed segments.", []string{"camera"}, nil)
+	recorderLastSegment = prometheus.NewDesc(namespace+"_recorder_last_segment_timestamp_seconds",
+		"When the last segment was completed.", []string{"camera"}, nil)
+
+	purgeRuns = prometheus.NewDesc(namespace+"_purge_runs_total",
+		"Runs of the purge of old recordings.", nil, nil)
+	purgeLastRun = prometheus.NewDesc(namespace+"_purge_last_run_timestamp_seconds",
+		"When the purge of old recordings last ran.", nil, nil)
+	purgeDeletedFiles = prometheus.NewDesc(namespace+"_purge_deleted_files_total",
+		"Recordings deleted by the purge.", []string{"camera"}, nil)
+	purgeDeletedBytes = prometheus.NewDesc(namespace+"_purge_deleted_bytes_total",
+		"Size of the recordings deleted by the purge.", []string{"camera"}, nil)
+
+	storageFree = prometheus.NewDesc(namespace+"_storage_free_bytes",
+		"Free space of the filesystem of the recordings.", nil, nil)
+	storageTotal = prometheus.NewDesc(namespace+"_storage_size_bytes",
+		"Size of the filesystem of the recordings.", nil, nil)
+)
+
+// collector reads the metrics from the recorders and the purge when scraped
+type collector struct{}
+
+func (collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		recorderUp, recorderRestarts, recorderUptime, recorderBytes, recorderSegments, recorderLastSegment,
+		purgeRuns, purgeLastRun, purgeDeletedFiles, purgeDeletedBytes,
+		storageFree, storageTotal,
+	} {
+		ch <- desc
+	}
+}
+
+func (collector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	current := config.Current()
+
+	for _, status := range recorders.Status() {
+		camera := status.CameraId
+
+		up, uptime := 0.0, 0.0
+		if status.State == recorders.StateRecording {
+			up = 1
+			uptime = now.Sub(status.StartedAt).Seconds()
+		}
+
+		ch <- prometheus.MustNewConstMetric(recorderUp, prometheus.GaugeValue, up, camera)
+		ch <- prometheus.MustNewConstMetric(recorderUptime, prometheus.GaugeValue, uptime, camera)
+		ch <- prometheus.MustNewConstMetric(recorderRestarts, prometheus.CounterValue, float64(status.Restarts), camera)
+		ch <- prometheus.MustNewConstMetric(recorderBytes, prometheus.CounterValue, float64(status.BytesWritten), camera)
+		ch <- prometheus.MustNewConstMetric(recorderSegments, prometheus.CounterValue, float64(status.SegmentsCompleted), camera)
+		if !status.LastSegmentAt.IsZero() {
+			ch <- prometheus.MustNewConstMetric(recorderLastSegment, prometheus.GaugeValue, unixSeconds(status.LastSegmentAt), camera)
+		}
+	}
+
+	stats := files.GetPurgeStats()
+	ch <- prometheus.MustNewConstMetric(purgeRuns, prometheus.CounterValue, float64(stats.Runs))
+	if !stats.LastRun.IsZero() {
+		ch <- prometheus.MustNewConstMetric(purgeLastRun, prometheus.GaugeValue, unixSeconds(stats.LastRun))
+	}
+	for _, camera := range current.Cameras {
+		ch <- prometheus.MustNewConstMetric(purgeDeletedFiles, prometheus.CounterValue,
+			float64(stats.DeletedFiles[camera.Id]), camera.Id)
+		ch <- prometheus.MustNewConstMetric(purgeDeletedBytes, prometheus.CounterValue,
+			float64(stats.DeletedBytes[camera.Id]), camera.Id)
+	}
+
+	usage, err := files.GetDiskUsage(current.Storage.Path)
+	if err != nil {
+		logger.Warn("HTTP > Error checking the free space for the metrics: %v", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(storageFree, prometheus.GaugeValue, float64(usage.Free))
+	ch <- prometheus.MustNewConstMetric(storageTotal, prometheus.GaugeValue, float64(usage.Total))
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+// Handler serves the metrics in the Prometheus format
+func Handler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collector{},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/recorders"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCountersAcrossReloads(t *testing.T) {
+	config.Apply(&config.VigilisConfig{
+		Storage:  &config.Storage{Path: t.TempDir(), RetentionDays: 7, PathTemplate: config.DefaultPathTemplate},
+		Recorder: &config.Recorder{StallTimeout: time.Minute},
+		Cameras:  []*config.Camera{{Id: "a", Name: "A", SegmentSeconds: 10}},
+	})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+	}()
+
+	// ffmpeg is not set, so each start of a recorder fails and counts as a restart
+	waitRestarts := func(restarts int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			status := recorders.Status()
+			if len(status) == 1 && status[0].Restarts >= restarts {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	recorders.Init(config.Current().Cameras)
+	waitRestarts(1)
+
+	// The camera changed, so its recorder is replaced
+	recorders.Reload([]*config.Camera{{Id: "a", Name: "Renamed", SegmentSeconds: 10}})
+	waitRestarts(2)
+
+	expected := `
+# HELP vigilis_recorder_restarts_total Restarts of the recording process.
+# TYPE vigilis_recorder_restarts_total counter
+vigilis_recorder_restarts_total{camera="a"} 2
+# HELP vigilis_recorder_segments_completed_total Completed segments.
+# TYPE vigilis_recorder_segments_completed_total counter
+vigilis_recorder_segments_completed_total{camera="a"} 0
+`
+	err := testutil.CollectAndCompare(collector{}, strings.NewReader(expected),
+		"vigilis_recorder_restarts_total", "vigilis_recorder_segments_completed_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
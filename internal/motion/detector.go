@@ -0,0 +1,129 @@
+package motion
+
+import (
+	"time"
+	"vigilis/internal/config"
+)
+
+// Detector compares each grayscale frame with the previous one
+type Detector struct {
+	width, height int
+	threshold     int     // Brightness change of a pixel to be counted as changed
+	minArea       float64 // Percentage of the unmasked pixels that must change
+	masked        []bool  // Pixels that are ignored, nil without masks
+	unmasked      int
+	previous      []byte
+}
+
+// NewDetector creates a detector of frames of the size in the config
+func NewDetector(motion *config.Motion) *Detector {
+	d := &Detector{
+		width:  motion.Width,
+		height: motion.Height,
+		// Sensitivity 100 counts any change, 1 only changes of a quarter of the brightness range
+		threshold: 1 + (100-motion.Sensitivity)*64/100,
+		minArea:   motion.MinArea,
+		unmasked:  motion.Width * motion.Height,
+	}
+
+	if len(motion.Masks) > 0 {
+		d.masked = make([]bool, motion.Width*motion.Height)
+		for _, mask := range motion.Masks {
+			x0, x1 := scale(mask.X, d.width), scale(mask.X+mask.Width, d.width)
+			y0, y1 := scale(mask.Y, d.height), scale(mask.Y+mask.Height, d.height)
+
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					d.masked[y*d.width+x] = true
+				}
+			}
+		}
+
+		d.unmasked = 0
+		for _, masked := range d.masked {
+			if !masked {
+				d.unmasked++
+			}
+		}
+	}
+
+	return d
+}
+
+// scale converts a percentage of the size to a pixel position
+func scale(percentage float64, size int) int {
+	return min(size, max(0, int(percentage*float64(size)/100+0.5)))
+}
+
+// FrameSize is the length of the frames, one byte per pixel
+func (d *Detector) FrameSize() int {
+	return d.width * d.height
+}
+
+// Detect compares the frame with the previous one, returning the percentage of the unmasked pixels that changed.
+// The first frame never has motion.
+func (d *Detector) Detect(frame []byte) (changed float64, motion bool) {
+	previous := d.previous
+	d.previous = append(d.previous[:0:0], frame...)
+
+	if previous == nil || d.unmasked == 0 {
+		return 0, false
+	}
+
+	count := 0
+	for i := range frame {
+		if d.masked != nil && d.masked[i] {
+			continue
+		}
+
+		diff := int(frame[i]) - int(previous[i])
+		if diff >= d.threshold || -diff >= d.threshold {
+			count++
+		}
+	}
+
+	changed = float64(count) / float64(d.unmasked) * 100
+	return changed, changed >= d.minArea
+}
+
+// Event is a period with motion
+type Event struct {
+	Start time.Time
+	End   time.Time // Last frame with motion
+	Peak  float64   // Highest percentage of the frame that changed
+}
+
+// Tracker turns the detections of each frame into motion events
+type Tracker struct {
+	cooldown time.Duration
+	current  *Event // Nil without motion
+}
+
+func NewTracker(cooldown time.Duration) *Tracker {
+	return &Tracker{cooldown: cooldown}
+}
+
+// Update adds the detection of a frame, returning if the motion started,
+// or the event once there was no motion for the cooldown
+func (t *Tracker) Update(now time.Time, changed float64, motion bool) (started bool, ended *Event) {
+	switch {
+	case motion && t.current == nil:
+		t.current = &Event{Start: now, End: now, Peak: changed}
+		return true, nil
+	case motion:
+		t.current.End = now
+		t.current.Peak = max(t.current.Peak, changed)
+	case t.current != nil && now.Sub(t.current.End) >= t.cooldown:
+		return false, t.Stop()
+	}
+
+	return false, nil
+}
+
+// Stop ends the ongoing motion, returning its event if there was motion
+func (t *Tracker) Stop() *Event {
+	ended := t.current
+	t.current = nil
+
+	return ended
+}
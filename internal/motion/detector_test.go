@@ -0,0 +1,76 @@
+package motion
+
+import (
+	"bytes"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+)
+
+func TestDetect(t *testing.T) {
+	d := NewDetector(&config.Motion{
+		Width:       10,
+		Height:      10,
+		Sensitivity: 50,
+		MinArea:     5,
+		// The left half of the frame is ignored
+		Masks: []*config.MotionMask{{X: 0, Y: 0, Width: 50, Height: 100}},
+	})
+
+	background := bytes.Repeat([]byte{100}, d.FrameSize())
+	if _, motion := d.Detect(background); motion {
+		t.Error("expected no motion on the first frame")
+	}
+
+	// Small brightness changes are noise
+	noise := bytes.Repeat([]byte{110}, d.FrameSize())
+	if changed, motion := d.Detect(noise); motion || changed != 0 {
+		t.Errorf("expected no motion on noise, got %v%%", changed)
+	}
+
+	// Changes in the mask are ignored
+	masked := bytes.Clone(noise)
+	for y := range 10 {
+		masked[y*10] = 255
+	}
+	if changed, motion := d.Detect(masked); motion || changed != 0 {
+		t.Errorf("expected no motion in the mask, got %v%%", changed)
+	}
+
+	// 3 of the 50 unmasked pixels change
+	moving := bytes.Clone(masked)
+	moving[5], moving[6], moving[7] = 255, 255, 255
+	changed, motion := d.Detect(moving)
+	if !motion || changed != 6 {
+		t.Errorf("expected motion on 6%% of the frame, got %v%% %v", changed, motion)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker(10 * time.Second)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	started, ended := tracker.Update(start, 5, true)
+	if !started || ended != nil {
+		t.Fatal("expected the motion to start")
+	}
+
+	tracker.Update(start.Add(2*time.Second), 20, true)
+
+	// The motion continues during the cooldown
+	if started, ended = tracker.Update(start.Add(11*time.Second), 0, false); started || ended != nil {
+		t.Fatal("expected the motion to continue during the cooldown")
+	}
+
+	_, ended = tracker.Update(start.Add(12*time.Second), 0, false)
+	if ended == nil {
+		t.Fatal("expected the motion to end after the cooldown")
+	}
+	if !ended.Start.Equal(start) || !ended.End.Equal(start.Add(2*time.Second)) || ended.Peak != 20 {
+		t.Errorf("unexpected event %+v", ended)
+	}
+
+	if tracker.Stop() != nil {
+		t.Error("expected no ongoing motion")
+	}
+}
@@ -0,0 +1,217 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"slices"
+	"vigilis/internal/config"
+)
+
+// See https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+
+type device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	SwVersion    string   `json:"sw_version,omitempty"`
+	ViaDevice    string   `json:"via_device,omitempty"`
+}
+
+// entity is the discovery config of a Home Assistant entity
+type entity struct {
+	component string // switch, sensor or binary_sensor
+	objectId  string
+
+	Name                string  `json:"name"`
+	UniqueId            string  `json:"unique_id"`
+	Device              *device `json:"device"`
+	AvailabilityTopic   string  `json:"availability_topic"`
+	StateTopic          string  `json:"state_topic,omitempty"` // Buttons have no state
+	CommandTopic        string  `json:"command_topic,omitempty"`
+	JsonAttributesTopic string  `json:"json_attributes_topic,omitempty"`
+	ValueTemplate       string  `json:"value_template,omitempty"`
+	PayloadOn           string  `json:"payload_on,omitempty"`
+	PayloadOff          string  `json:"payload_off,omitempty"`
+	PayloadPress        string  `json:"payload_press,omitempty"`
+	DeviceClass         string  `json:"device_class,omitempty"`
+	StateClass          string  `json:"state_class,omitempty"`
+	Unit                string  `json:"unit_of_measurement,omitempty"`
+	SuggestedUnit       string  `json:"suggested_unit_of_measurement,omitempty"`
+	EntityCategory      string  `json:"entity_category,omitempty"`
+	Icon                string  `json:"icon,omitempty"`
+}
+
+// topic returns the discovery topic of the entity
+func (e *entity) topic(mqttConfig *config.Mqtt) string {
+	return mqttConfig.DiscoveryPrefix + "/" + e.component + "/" + mqttConfig.ClientId + "/" + e.objectId + "/config"
+}
+
+func (e *entity) payload() []byte {
+	// Only has strings and pointers to structs with strings
+	payload, _ := json.Marshal(e)
+	return payload
+}
+
+// vigilisDevice is the device of vigilis itself, the cameras are connected through it
+func vigilisDevice(mqttConfig *config.Mqtt, version string) *device {
+	return &device{
+		Identifiers:  []string{mqttConfig.ClientId},
+		Name:         "Vigilis",
+		Manufacturer: "Vigilis",
+		Model:        "NVR",
+		SwVersion:    version,
+	}
+}
+
+// storageEntities are the sensors of the recordings storage
+func storageEntities(mqttConfig *config.Mqtt, version string) []*entity {
+	t := topics{mqttConfig.TopicPrefix}
+	vigilis := vigilisDevice(mqttConfig, version)
+	id := mqttConfig.ClientId
+
+	return []*entity{
+		{
+			component:         "sensor",
+			objectId:          "storage_free",
+			Name:              "Storage free",
+			UniqueId:          id + "_storage_free",
+			Device:            vigilis,
+			AvailabilityTopic: t.status(),
+			StateTopic:        t.storage(),
+			ValueTemplate:     "{{ value_json.free_bytes }}",
+			DeviceClass:       "data_size",
+			StateClass:        "measurement",
+			Unit:              "B",
+			SuggestedUnit:     "GB",
+		},
+		{
+			component:         "sensor",
+			objectId:          "storage_used",
+			Name:              "Storage used",
+			UniqueId:          id + "_storage_used",
+			Device:            vigilis,
+			AvailabilityTopic: t.status(),
+			StateTopic:        t.storage(),
+			ValueTemplate:     "{{ value_json.used_percent }}",
+			StateClass:        "measurement",
+			Unit:              "%",
+			Icon:              "mdi:harddisk",
+		},
+	}
+}
+
+// cameraDevice is the device of a camera, connected through vigilis
+func cameraDevice(mqttConfig *config.Mqtt, camera *config.Camera) *device {
+	return &device{
+		Identifiers:  []string{mqttConfig.ClientId + "_" + camera.Id},
+		Name:         camera.Name,
+		Manufacturer: "Vigilis",
+		Model:        "Camera",
+		ViaDevice:    mqttConfig.ClientId,
+	}
+}
+
+// cameraEntities are the entities of a camera, grouped in a device
+func cameraEntities(mqttConfig *config.Mqtt, camera *config.Camera) []*entity {
+	t := topics{mqttConfig.TopicPrefix}
+	id := mqttConfig.ClientId + "_" + camera.Id
+	camDevice := cameraDevice(mqttConfig, camera)
+
+	entities := []*entity{
+		{
+			component:           "switch",
+			objectId:            camera.Id + "_recording",
+			Name:                "Recording",
+			UniqueId:            id + "_recording",
+			Device:              camDevice,
+			AvailabilityTopic:   t.status(),
+			StateTopic:          t.recording(camera.Id),
+			CommandTopic:        t.recordingSet(camera.Id),
+			JsonAttributesTopic: t.cameraStatus(camera.Id),
+			PayloadOn:           payloadOn,
+			PayloadOff:          payloadOff,
+			Icon:                "mdi:record-rec",
+		},
+		{
+			component:         "binary_sensor",
+			objectId:          camera.Id + "_connectivity",
+			Name:              "Connectivity",
+			UniqueId:          id + "_connectivity",
+			Device:            camDevice,
+			AvailabilityTopic: t.status(),
+			StateTopic:        t.availability(camera.Id),
+			PayloadOn:         payloadOnline,
+			PayloadOff:        payloadOffline,
+			DeviceClass:       "connectivity",
+			EntityCategory:    "diagnostic",
+		},
+		{
+			component:         "sensor",
+			objectId:          camera.Id + "_state",
+			Name:              "Recorder state",
+			UniqueId:          id + "_state",
+			Device:            camDevice,
+			AvailabilityTopic: t.status(),
+			StateTopic:        t.state(camera.Id),
+			EntityCategory:    "diagnostic",
+			Icon:              "mdi:cctv",
+		},
+	}
+
+	if camera.Motion != nil {
+		entities = append(entities, motionEntity(mqttConfig, camera))
+	}
+	if camera.EventRecordingEnabled() {
+		entities = append(entities, &entity{
+			component:         "button",
+			objectId:          camera.Id + "_trigger",
+			Name:              "Trigger recording",
+			UniqueId:          id + "_trigger",
+			Device:            camDevice,
+			AvailabilityTopic: t.status(),
+			CommandTopic:      t.trigger(camera.Id),
+			PayloadPress:      payloadPress,
+			Icon:              "mdi:record-circle-outline",
+		})
+	}
+
+	return entities
+}
+
+// discoveryChanged checks if the entities of the camera changed with a config reload
+func discoveryChanged(previous, camera *config.Camera) bool {
+	return previous.Name != camera.Name ||
+		(previous.Motion == nil) != (camera.Motion == nil) ||
+		previous.EventRecordingEnabled() != camera.EventRecordingEnabled()
+}
+
+// removedEntities returns the previous entities that are not in the current ones
+func removedEntities(previous, current []*entity) []*entity {
+	var removed []*entity
+	for _, e := range previous {
+		if !slices.ContainsFunc(current, func(other *entity) bool { return other.objectId == e.objectId }) {
+			removed = append(removed, e)
+		}
+	}
+
+	return removed
+}
+
+// motionEntity is the motion sensor of a camera with motion detection
+func motionEntity(mqttConfig *config.Mqtt, camera *config.Camera) *entity {
+	t := topics{mqttConfig.TopicPrefix}
+	id := mqttConfig.ClientId + "_" + camera.Id
+
+	return &entity{
+		component:         "binary_sensor",
+		objectId:          camera.Id + "_motion",
+		Name:              "Motion",
+		UniqueId:          id + "_motion",
+		Device:            cameraDevice(mqttConfig, camera),
+		AvailabilityTopic: t.status(),
+		StateTopic:        t.motion(camera.Id),
+		PayloadOn:         payloadOn,
+		PayloadOff:        payloadOff,
+		DeviceClass:       "motion",
+	}
+}
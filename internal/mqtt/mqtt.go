@@ -0,0 +1,522 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/files"
+	"vigilis/internal/logger"
+	"vigilis/internal/notify"
+	"vigilis/internal/recorders"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	StateInterval   = 5 * time.Second // How often the state of the recorders is checked for changes
+	StorageInterval = time.Minute     // How often the storage usage is published
+	PublishTimeout  = 5 * time.Second
+	ConnectTimeout  = 10 * time.Second
+)
+
+// EventQueueSize is how many notification events can be waiting to be published, newer events are dropped
+const EventQueueSize = 100
+
+// DisconnectQuiesce is how long, in milliseconds, to wait for the pending messages when disconnecting
+const DisconnectQuiesce = 250
+
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+	payloadOn      = "ON"
+	payloadOff     = "OFF"
+	payloadPress   = "PRESS"
+)
+
+// topics builds the topics under the prefix of the config
+type topics struct {
+	prefix string
+}
+
+// status is online while vigilis is connected, the broker sets it offline when the connection is lost
+func (t topics) status() string { return t.prefix + "/status" }
+
+// storage has the usage of the recordings storage as JSON
+func (t topics) storage() string { return t.prefix + "/storage" }
+
+// events receives every notification event as JSON
+func (t topics) events() string { return t.prefix + "/events" }
+
+// availability is offline while the recorder of the camera is failing
+func (t topics) availability(cameraId string) string {
+	return t.prefix + "/" + cameraId + "/availability"
+}
+
+// state is the state of the recorder of the camera, for example recording or failed
+func (t topics) state(cameraId string) string { return t.prefix + "/" + cameraId + "/state" }
+
+// recording is ON while the camera is being recorded
+func (t topics) recording(cameraId string) string { return t.prefix + "/" + cameraId + "/recording" }
+
+// motion is ON while there is motion on the camera, only published when motion is detected
+func (t topics) motion(cameraId string) string { return t.prefix + "/" + cameraId + "/motion" }
+
+// recordingSet receives ON and OFF to start and stop the recorder of the camera
+func (t topics) recordingSet(cameraId string) string { return t.recording(cameraId) + "/set" }
+
+// trigger receives anything to keep the recordings around now, for the cameras with the events record
+func (t topics) trigger(cameraId string) string { return t.prefix + "/" + cameraId + "/trigger" }
+
+// cameraStatus has the full status of the recorder of the camera as JSON
+func (t topics) cameraStatus(cameraId string) string { return t.prefix + "/" + cameraId + "/status" }
+
+// commands matches the command topics of every camera
+func (t topics) commands() string { return t.recordingSet("+") }
+
+// triggers matches the trigger topics of every camera
+func (t topics) triggers() string { return t.trigger("+") }
+
+// commandCamera returns the camera of a command topic
+func (t topics) commandCamera(topic string) (string, bool) {
+	return t.topicCamera(topic, "/recording/set")
+}
+
+// triggerCamera returns the camera of a trigger topic
+func (t topics) triggerCamera(topic string) (string, bool) {
+	return t.topicCamera(topic, "/trigger")
+}
+
+// topicCamera returns the camera of a topic of the cameras ending with the suffix
+func (t topics) topicCamera(topic string, suffix string) (string, bool) {
+	rest, found := strings.CutPrefix(topic, t.prefix+"/")
+	if !found {
+		return "", false
+	}
+
+	cameraId, found := strings.CutSuffix(rest, suffix)
+	if !found || strings.Contains(cameraId, "/") {
+		return "", false
+	}
+
+	return cameraId, true
+}
+
+// cameraState is what was last published for a camera
+type cameraState struct {
+	availability string
+	state        string
+	recording    string
+	motion       string // Empty without motion detection
+	status       []byte
+}
+
+type storageState struct {
+	FreeBytes   uint64  `json:"free_bytes"`
+	TotalBytes  uint64  `json:"total_bytes"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+type client struct {
+	config  *config.Mqtt
+	version string
+	topics  topics
+	paho    paho.Client
+
+	connected chan struct{}     // Signals the loop that everything must be published again
+	refresh   chan struct{}     // Signals the loop that a command or a trigger changed a recorder
+	events    chan notify.Event // Notification events to be published by the loop
+	stopping  chan struct{}
+	done      chan struct{} // Closed when the loop returns
+
+	// Only used by the loop
+	published        map[string]cameraState
+	announced        map[string]*config.Camera // Cameras whose discovery config and state were published
+	announcedStorage bool
+}
+
+var current *client
+
+// Start connects to the broker in the background, if MQTT is enabled in the config
+func Start(version string) {
+	mqttConfig := config.Current().Mqtt
+	if mqttConfig == nil {
+		logger.Trace("MQTT disabled")
+		return
+	}
+
+	c := newClient(mqttConfig, version)
+
+	logger.Info("MQTT > Connecting to %v", redactUrl(mqttConfig.Broker))
+	c.paho.Connect() // Retried until it succeeds, onConnect is called once connected
+
+	go c.loop()
+	notify.Listen(c.queueEvent)
+
+	current = c
+}
+
+// Stop marks vigilis as offline and disconnects from the broker
+func Stop() {
+	c := current
+	if c == nil {
+		return
+	}
+
+	close(c.stopping)
+	<-c.done
+
+	if c.paho.IsConnected() {
+		c.publish(c.topics.status(), true, payloadOffline)
+	}
+	c.paho.Disconnect(DisconnectQuiesce)
+}
+
+func newClient(mqttConfig *config.Mqtt, version string) *client {
+	c := &client{
+		config:    mqttConfig,
+		version:   version,
+		topics:    topics{mqttConfig.TopicPrefix},
+		connected: make(chan struct{}, 1),
+		refresh:   make(chan struct{}, 1),
+		events:    make(chan notify.Event, EventQueueSize),
+		stopping:  make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	options := paho.NewClientOptions().
+		AddBroker(mqttConfig.Broker).
+		SetClientID(mqttConfig.ClientId).
+		SetUsername(mqttConfig.Username).
+		SetPassword(mqttConfig.Password).
+		SetWill(c.topics.status(), payloadOffline, 1, true).
+		SetConnectTimeout(ConnectTimeout).
+		SetConnectRetry(true).
+		SetAutoReconnect(true).
+		SetOrderMatters(false). // The handlers wait for the broker
+		SetOnConnectHandler(c.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logger.Warn("MQTT > Connection lost, reconnecting: %v", err)
+		})
+	c.paho = paho.NewClient(options)
+
+	return c
+}
+
+// onConnect is called on every (re)connection, the retained state may have been lost
+func (c *client) onConnect(_ paho.Client) {
+	logger.Info("MQTT > Connected to %v", redactUrl(c.config.Broker))
+
+	c.publish(c.topics.status(), true, payloadOnline)
+
+	for topic, handler := range map[string]paho.MessageHandler{
+		c.topics.commands(): c.handleCommand,
+		c.topics.triggers(): c.handleTrigger,
+	} {
+		token := c.paho.Subscribe(topic, 1, handler)
+		if !token.WaitTimeout(PublishTimeout) {
+			logger.Error("MQTT > Timeout subscribing to %v", topic)
+		} else if token.Error() != nil {
+			logger.Error("MQTT > Error subscribing to %v: %v", topic, token.Error())
+		}
+	}
+
+	signal(c.connected)
+}
+
+func (c *client) loop() {
+	defer close(c.done)
+
+	stateTicker := time.NewTicker(StateInterval)
+	defer stateTicker.Stop()
+	storageTicker := time.NewTicker(StorageInterval)
+	defer storageTicker.Stop()
+
+	for {
+		select {
+		case <-c.stopping:
+			return
+		case <-c.connected:
+			c.published = make(map[string]cameraState)
+			c.announced = make(map[string]*config.Camera)
+			c.announcedStorage = false
+
+			c.announce()
+			c.publishStates()
+			c.publishStorage()
+		case <-c.refresh:
+			c.publishStates()
+		case event := <-c.events:
+			c.publishEvent(event)
+		case <-stateTicker.C:
+			// Cameras may have been added or removed by a config reload
+			c.announce()
+			c.publishStates()
+		case <-storageTicker.C:
+			c.publishStorage()
+		}
+	}
+}
+
+// announce publishes the discovery config of the new cameras and removes the ones of the removed cameras
+func (c *client) announce() {
+	if !c.paho.IsConnected() || c.announced == nil {
+		return
+	}
+
+	discovery := c.config.DiscoveryEnabled()
+
+	if discovery && !c.announcedStorage {
+		for _, e := range storageEntities(c.config, c.version) {
+			c.publish(e.topic(c.config), true, e.payload())
+		}
+		c.announcedStorage = true
+	}
+
+	cameras := make(map[string]bool)
+	for _, camera := range config.Current().Cameras {
+		cameras[camera.Id] = true
+
+		previous, exists := c.announced[camera.Id]
+		if exists && !discoveryChanged(previous, camera) {
+			continue
+		}
+
+		if discovery {
+			entities := cameraEntities(c.config, camera)
+			for _, e := range entities {
+				c.publish(e.topic(c.config), true, e.payload())
+			}
+
+			// Entities disabled by a config reload, like the motion sensor
+			if exists {
+				for _, e := range removedEntities(cameraEntities(c.config, previous), entities) {
+					c.publish(e.topic(c.config), true, "")
+				}
+			}
+		}
+		if exists && previous.Motion != nil && camera.Motion == nil {
+			c.publish(c.topics.motion(camera.Id), true, "")
+		}
+		c.announced[camera.Id] = camera
+	}
+
+	for id, camera := range c.announced {
+		if cameras[id] {
+			continue
+		}
+
+		logger.Trace("MQTT > Removing camera %v", id)
+
+		// Empty retained messages delete the discovery config and the retained state
+		if discovery {
+			for _, e := range cameraEntities(c.config, camera) {
+				c.publish(e.topic(c.config), true, "")
+			}
+		}
+		for _, topic := range []string{
+			c.topics.availability(id), c.topics.state(id), c.topics.recording(id), c.topics.motion(id), c.topics.cameraStatus(id),
+		} {
+			c.publish(topic, true, "")
+		}
+
+		delete(c.announced, id)
+		delete(c.published, id)
+	}
+}
+
+// publishStates publishes the state of the recorders that changed since the last time
+func (c *client) publishStates() {
+	if !c.paho.IsConnected() || c.published == nil {
+		return
+	}
+
+	current := config.Current()
+	for _, status := range recorders.Status() {
+		id := status.CameraId
+
+		state := cameraState{
+			availability: payloadOnline,
+			state:        status.State.String(),
+			recording:    payloadOff,
+		}
+		if status.State == recorders.StateBackoff || status.State == recorders.StateFailed {
+			state.availability = payloadOffline
+		}
+		if status.State == recorders.StateRecording {
+			state.recording = payloadOn
+		}
+		if camera := current.FindCamera(id); camera != nil && camera.Motion != nil {
+			state.motion = payloadOff
+			if status.Motion {
+				state.motion = payloadOn
+			}
+		}
+
+		var err error
+		state.status, err = json.Marshal(status)
+		if err != nil {
+			logger.Error("MQTT > Error encoding the status of camera %v: %v", id, err)
+			continue
+		}
+
+		previous, exists := c.published[id]
+		if !exists || previous.availability != state.availability {
+			c.publish(c.topics.availability(id), true, state.availability)
+		}
+		if !exists || previous.state != state.state {
+			c.publish(c.topics.state(id), true, state.state)
+		}
+		if !exists || previous.recording != state.recording {
+			c.publish(c.topics.recording(id), true, state.recording)
+		}
+		if state.motion != "" && (!exists || previous.motion != state.motion) {
+			c.publish(c.topics.motion(id), true, state.motion)
+		}
+		if !exists || !bytes.Equal(previous.status, state.status) {
+			c.publish(c.topics.cameraStatus(id), true, state.status)
+		}
+
+		c.published[id] = state
+	}
+}
+
+// publishStorage publishes the usage of the recordings storage
+func (c *client) publishStorage() {
+	if !c.paho.IsConnected() {
+		return
+	}
+
+	usage, err := files.GetDiskUsage(config.Current().Storage.Path)
+	if err != nil {
+		logger.Warn("MQTT > Error checking the free space: %v", err)
+		return
+	}
+
+	storage := storageState{FreeBytes: usage.Free, TotalBytes: usage.Total}
+	if usage.Total > 0 {
+		used := float64(usage.Total-usage.Free) / float64(usage.Total) * 100
+		storage.UsedPercent = math.Round(used*10) / 10
+	}
+
+	payload, err := json.Marshal(storage)
+	if err != nil {
+		logger.Error("MQTT > Error encoding the storage usage: %v", err)
+		return
+	}
+
+	c.publish(c.topics.storage(), true, payload)
+}
+
+// queueEvent queues a notification event to be published by the loop, as it's called by notify.Send
+func (c *client) queueEvent(event notify.Event) {
+	select {
+	case c.events <- event:
+	default:
+		logger.Warn("MQTT > The broker is not keeping up, dropping %v event", event.Type)
+	}
+}
+
+// publishEvent publishes a notification event
+func (c *client) publishEvent(event notify.Event) {
+	if !c.paho.IsConnected() {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("MQTT > Error encoding %v event: %v", event.Type, err)
+		return
+	}
+
+	c.publish(c.topics.events(), false, payload)
+
+	// Publish the motion now rather than with the next state check
+	if event.Type == config.EventMotionStart || event.Type == config.EventMotionEnd {
+		c.publishStates()
+	}
+}
+
+// publish publishes a message and waits for the broker to receive it
+func (c *client) publish(topic string, retained bool, payload any) {
+	token := c.paho.Publish(topic, 1, retained, payload)
+	if !token.WaitTimeout(PublishTimeout) {
+		logger.Warn("MQTT > Timeout publishing to %v", topic)
+		return
+	}
+
+	if token.Error() != nil {
+		logger.Warn("MQTT > Error publishing to %v: %v", topic, token.Error())
+	}
+}
+
+// handleCommand starts or stops the recorder of a camera
+func (c *client) handleCommand(_ paho.Client, message paho.Message) {
+	cameraId, ok := c.topics.commandCamera(message.Topic())
+	if !ok {
+		return
+	}
+
+	var err error
+	switch command := strings.ToUpper(strings.TrimSpace(string(message.Payload()))); command {
+	case payloadOn:
+		err = recorders.StartCamera(cameraId)
+	case payloadOff:
+		err = recorders.StopCamera(cameraId)
+	default:
+		logger.Warn("MQTT > Unknown command %q for camera %v, expected %v or %v", command, cameraId, payloadOn, payloadOff)
+		return
+	}
+
+	if errors.Is(err, recorders.ErrCameraNotFound) {
+		logger.Warn("MQTT > Command for unknown camera %v", cameraId)
+		return
+	}
+	if err != nil {
+		logger.Warn("MQTT > Unable to apply the command to camera %v: %v", cameraId, err)
+	}
+
+	signal(c.refresh)
+}
+
+// handleTrigger keeps the recordings of a camera with the events record around now, whatever the payload
+func (c *client) handleTrigger(_ paho.Client, message paho.Message) {
+	cameraId, ok := c.topics.triggerCamera(message.Topic())
+	if !ok {
+		return
+	}
+
+	_, err := recorders.Trigger(cameraId, "MQTT")
+	if errors.Is(err, recorders.ErrCameraNotFound) {
+		logger.Warn("MQTT > Trigger for unknown camera %v", cameraId)
+		return
+	}
+	if err != nil {
+		logger.Warn("MQTT > Unable to trigger camera %v: %v", cameraId, err)
+		return
+	}
+
+	signal(c.refresh)
+}
+
+// signal wakes up the loop without blocking, a pending signal is enough
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// redactUrl hides the password of the broker URL, if any
+func redactUrl(broker string) string {
+	parsed, err := url.Parse(broker)
+	if err != nil {
+		return broker
+	}
+
+	return parsed.Redacted()
+}
@@ -0,0 +1,141 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestCommandCamera(t *testing.T) {
+	topics := topics{"home/vigilis"}
+
+	cases := []struct {
+		topic    string
+		cameraId string
+		ok       bool
+	}{
+		{"home/vigilis/outdoor/recording/set", "outdoor", true},
+		{"home/vigilis/outdoor/recording", "", false},
+		{"home/vigilis/a/b/recording/set", "", false},
+		{"vigilis/outdoor/recording/set", "", false},
+	}
+
+	for _, c := range cases {
+		cameraId, ok := topics.commandCamera(c.topic)
+		if cameraId != c.cameraId || ok != c.ok {
+			t.Errorf("%v: expected %q %v, got %q %v", c.topic, c.cameraId, c.ok, cameraId, ok)
+		}
+	}
+
+	if cameraId, ok := topics.triggerCamera("home/vigilis/outdoor/trigger"); cameraId != "outdoor" || !ok {
+		t.Errorf("expected the trigger of outdoor, got %q %v", cameraId, ok)
+	}
+	if _, ok := topics.triggerCamera("home/vigilis/outdoor/recording/set"); ok {
+		t.Error("expected a command to not be a trigger")
+	}
+}
+
+func TestCameraEntities(t *testing.T) {
+	mqttConfig := &config.Mqtt{ClientId: "nvr", TopicPrefix: "vigilis", DiscoveryPrefix: "homeassistant"}
+	camera := &config.Camera{Id: "outdoor", Name: "Outdoor"}
+
+	entities := cameraEntities(mqttConfig, camera)
+
+	recording := entities[0]
+	if topic := recording.topic(mqttConfig); topic != "homeassistant/switch/nvr/outdoor_recording/config" {
+		t.Errorf("unexpected discovery topic %v", topic)
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(recording.payload(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["command_topic"] != "vigilis/outdoor/recording/set" || payload["state_topic"] != "vigilis/outdoor/recording" {
+		t.Errorf("unexpected topics in %v", payload)
+	}
+	if payload["unique_id"] != "nvr_outdoor_recording" {
+		t.Errorf("unexpected unique id %v", payload["unique_id"])
+	}
+
+	device := payload["device"].(map[string]any)
+	if device["name"] != "Outdoor" || device["via_device"] != "nvr" {
+		t.Errorf("unexpected device %v", device)
+	}
+}
+
+// TestBroker connects to a real broker, for example tcp://localhost:1883, set in VIGILIS_TEST_MQTT_BROKER
+func TestBroker(t *testing.T) {
+	broker := os.Getenv("VIGILIS_TEST_MQTT_BROKER")
+	if broker == "" {
+		t.Skip("VIGILIS_TEST_MQTT_BROKER is not set")
+	}
+
+	discovery := true
+	config.Apply(&config.VigilisConfig{
+		Storage: &config.Storage{Path: t.TempDir()},
+		Cameras: []*config.Camera{{Id: "outdoor", Name: "Outdoor"}},
+		Mqtt: &config.Mqtt{
+			Broker:          broker,
+			ClientId:        "vigilis-test",
+			TopicPrefix:     "vigilis-test",
+			Discovery:       &discovery,
+			DiscoveryPrefix: "homeassistant-test",
+		},
+	})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+		current = nil
+	}()
+
+	messages := make(chan paho.Message, 100)
+	subscriber := paho.NewClient(paho.NewClientOptions().AddBroker(broker).SetClientID("vigilis-test-subscriber"))
+	if token := subscriber.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	defer subscriber.Disconnect(DisconnectQuiesce)
+
+	token := subscriber.SubscribeMultiple(map[string]byte{"vigilis-test/#": 1, "homeassistant-test/#": 1},
+		func(_ paho.Client, message paho.Message) {
+			messages <- message
+		})
+	if token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	Start("test")
+
+	// wait returns the payload of the first message published to the topic after the given one
+	wait := func(topic string) string {
+		timeout := time.After(ConnectTimeout)
+		for {
+			select {
+			case message := <-messages:
+				if message.Topic() == topic {
+					return string(message.Payload())
+				}
+			case <-timeout:
+				t.Fatalf("nothing published to %v", topic)
+			}
+		}
+	}
+
+	if status := wait("vigilis-test/status"); status != payloadOnline {
+		t.Errorf("expected vigilis to be online, got %q", status)
+	}
+	if payload := wait("homeassistant-test/switch/vigilis-test/outdoor_recording/config"); payload == "" {
+		t.Error("expected the recording switch to be announced")
+	}
+	if payload := wait("vigilis-test/storage"); payload == "" {
+		t.Error("expected the storage usage to be published")
+	}
+
+	Stop()
+
+	if status := wait("vigilis-test/status"); status != payloadOffline {
+		t.Errorf("expected vigilis to be offline, got %q", status)
+	}
+}
@@ -0,0 +1,351 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/logger"
+)
+
+const (
+	EmailTimeout    = 30 * time.Second // Timeout of each delivery
+	EmailAttempts   = 3                // Deliveries tried before giving up on a mail
+	EmailRetryDelay = 10 * time.Second // Delay between the deliveries
+)
+
+// MaxSnapshots is how many camera pictures are attached to a digest
+const MaxSnapshots = 5
+
+// Snapshot grabs a JPEG picture of the camera, it's set when the pictures can be taken
+var Snapshot func(ctx context.Context, cameraId string) ([]byte, error)
+
+type email struct {
+	config  *config.Email
+	pending []Event // Waiting for the digest
+}
+
+func newEmail(emailConfig *config.Email) *email {
+	return &email{config: emailConfig}
+}
+
+func (e *email) Name() string {
+	return "email " + e.config.Host
+}
+
+func (e *email) Wants(event Event) bool {
+	return e.config.Wants(event.Type)
+}
+
+// Notify mails the event, or keeps it for the digest
+func (e *email) Notify(ctx context.Context, event Event) error {
+	if e.config.Digest > 0 {
+		e.pending = append(e.pending, event)
+		return nil
+	}
+
+	return e.send(ctx, []Event{event})
+}
+
+func (e *email) FlushInterval() time.Duration {
+	return e.config.Digest
+}
+
+// Flush mails the digest of the pending events
+func (e *email) Flush(ctx context.Context) error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+
+	events := e.pending
+	e.pending = nil
+
+	return e.send(ctx, events)
+}
+
+// recipientGroup are the events mailed to the same recipients
+type recipientGroup struct {
+	to     []string
+	events []Event
+}
+
+// groupByRecipients groups the events by their recipients, which depend on the camera
+func (e *email) groupByRecipients(events []Event) []recipientGroup {
+	current := config.Current()
+
+	var groups []recipientGroup
+	for _, event := range events {
+		to := e.config.Recipients(current.FindCamera(event.CameraId))
+
+		i := slices.IndexFunc(groups, func(group recipientGroup) bool {
+			return slices.Equal(group.to, to)
+		})
+		if i == -1 {
+			groups = append(groups, recipientGroup{to: to})
+			i = len(groups) - 1
+		}
+
+		groups[i].events = append(groups[i].events, event)
+	}
+
+	return groups
+}
+
+// send mails the events, once for each group of recipients
+func (e *email) send(ctx context.Context, events []Event) error {
+	var errs []error
+	for _, group := range e.groupByRecipients(events) {
+		message, err := buildMessage(e.config.From, group.to, group.events, e.snapshots(ctx, group.events), time.Now())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		errs = append(errs, e.deliverWithRetries(ctx, group.to, message))
+	}
+
+	return errors.Join(errs...)
+}
+
+// snapshots grabs a picture of the cameras of the events, when enabled
+func (e *email) snapshots(ctx context.Context, events []Event) map[string][]byte {
+	if !e.config.Snapshot || Snapshot == nil {
+		return nil
+	}
+
+	pictures := make(map[string][]byte)
+	for _, event := range events {
+		if event.CameraId == "" || len(pictures) == MaxSnapshots {
+			continue
+		}
+		if _, exists := pictures[event.CameraId]; exists {
+			continue
+		}
+
+		picture, err := Snapshot(ctx, event.CameraId)
+		if err != nil {
+			logger.Warn("Unable to take a picture of camera %v for the email: %v", event.CameraId, err)
+			continue
+		}
+		pictures[event.CameraId] = picture
+	}
+
+	return pictures
+}
+
+func (e *email) deliverWithRetries(ctx context.Context, to []string, message []byte) error {
+	for attempt := 1; ; attempt++ {
+		err := e.deliver(ctx, to, message)
+		if err == nil || !retryable(err) || attempt == EmailAttempts {
+			return err
+		}
+
+		logger.Warn("Error sending the email to %v, retrying in %v: %v", e.config.Host, EmailRetryDelay, err)
+
+		select {
+		case <-time.After(EmailRetryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// retryable checks if the delivery may succeed later, SMTP 5xx replies are permanent failures
+func retryable(err error) bool {
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code < 500
+	}
+
+	return true
+}
+
+// deliver sends the message through the SMTP server
+func (e *email) deliver(ctx context.Context, to []string, message []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, EmailTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	tlsConfig := &tls.Config{ServerName: e.config.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{}
+	if e.config.Security == config.EmailSecurityTls {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Abort the delivery on timeout or when stopping
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	client, err := smtp.NewClient(conn, e.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if e.config.Security == config.EmailSecurityStartTls {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("the server doesn't support STARTTLS")
+		}
+
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	if e.config.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(e.config.From)
+	if err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		err = client.Rcpt(recipient)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = data.Write(message)
+	if err != nil {
+		return err
+	}
+	err = data.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// subject summarizes the events in the subject of the mail
+func subject(events []Event) string {
+	if len(events) > 1 {
+		return fmt.Sprintf("[Vigilis] %d events", len(events))
+	}
+
+	event := events[0]
+	title := strings.ReplaceAll(event.Type, "_", " ")
+	if event.CameraId == "" {
+		return "[Vigilis] " + title
+	}
+
+	return "[Vigilis] " + cameraName(event.CameraId) + ": " + title
+}
+
+// cameraName returns the name of the camera, or its id if it was removed
+func cameraName(cameraId string) string {
+	camera := config.Current().FindCamera(cameraId)
+	if camera == nil {
+		return cameraId
+	}
+
+	return camera.Name
+}
+
+// buildMessage builds the mail of the events, with the pictures of their cameras attached
+func buildMessage(from string, to []string, events []Event, pictures map[string][]byte, date time.Time) ([]byte, error) {
+	var message bytes.Buffer
+	body := multipart.NewWriter(&message)
+
+	headers := []string{
+		"From: " + from,
+		"To: " + strings.Join(to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject(events)),
+		"Date: " + date.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/mixed; boundary=" + body.Boundary(),
+	}
+	message.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	text, err := body.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encoder := quotedprintable.NewWriter(text)
+	for _, event := range events {
+		source := "Vigilis"
+		if event.CameraId != "" {
+			source = fmt.Sprintf("%v (%v)", cameraName(event.CameraId), event.CameraId)
+		}
+
+		fmt.Fprintf(encoder, "%v - %v - %v\r\n%v\r\n\r\n",
+			event.Time.Local().Format(time.DateTime), source, strings.ReplaceAll(event.Type, "_", " "), event.Message)
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Attach the pictures in the order of the events
+	attached := make(map[string]bool)
+	for _, event := range events {
+		picture, exists := pictures[event.CameraId]
+		if !exists || attached[event.CameraId] {
+			continue
+		}
+		attached[event.CameraId] = true
+
+		filename := event.CameraId + "-" + event.Time.Local().Format("20060102-150405") + ".jpg"
+		attachment, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"image/jpeg"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {`attachment; filename="` + filename + `"`},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Lines of base64 are limited to 76 characters
+		encoded := base64.StdEncoding.EncodeToString(picture)
+		for len(encoded) > 76 {
+			fmt.Fprintf(attachment, "%v\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(attachment, "%v\r\n", encoded)
+	}
+
+	err = body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return message.Bytes(), nil
+}
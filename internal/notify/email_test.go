@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+)
+
+// received is a mail accepted by the fake SMTP server
+type received struct {
+	to      []string
+	message *mail.Message
+}
+
+// fakeSmtpServer accepts the mails without encryption or authentication
+func fakeSmtpServer(t *testing.T) (port int, mails chan received) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	mails = make(chan received, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				text := textproto.NewConn(conn)
+				text.PrintfLine("220 localhost ready")
+
+				var to []string
+				for {
+					line, err := text.ReadLine()
+					if err != nil {
+						return
+					}
+
+					command, argument, _ := strings.Cut(line, " ")
+					switch strings.ToUpper(command) {
+					case "EHLO", "HELO":
+						text.PrintfLine("250 localhost")
+					case "RCPT":
+						to = append(to, strings.Trim(strings.TrimPrefix(argument, "TO:"), "<>"))
+						text.PrintfLine("250 OK")
+					case "DATA":
+						text.PrintfLine("354 Go ahead")
+
+						message, err := mail.ReadMessage(text.DotReader())
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						mails <- received{to: to, message: message}
+
+						text.PrintfLine("250 OK")
+					case "QUIT":
+						text.PrintfLine("221 Bye")
+						return
+					default:
+						text.PrintfLine("250 OK")
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, mails
+}
+
+func TestEmailDigest(t *testing.T) {
+	port, mails := fakeSmtpServer(t)
+
+	config.Apply(&config.VigilisConfig{
+		Cameras: []*config.Camera{
+			{Id: "outdoor", Name: "Outdoor"},
+			{Id: "garage", Name: "Garage", EmailTo: []string{"garage@example.com"}},
+		},
+	})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+		Snapshot = nil
+	}()
+
+	Snapshot = func(_ context.Context, cameraId string) ([]byte, error) {
+		return []byte("jpeg of " + cameraId), nil
+	}
+
+	e := newEmail(&config.Email{
+		Host:     "127.0.0.1",
+		Port:     port,
+		Security: config.EmailSecurityNone,
+		From:     "vigilis@example.com",
+		To:       []string{"admin@example.com", "security@example.com"},
+		Events:   config.DefaultEmailEvents,
+		Digest:   time.Hour,
+		Snapshot: true,
+	})
+
+	now := time.Now()
+	for _, event := range []Event{
+		{Type: config.EventRecorderFailed, CameraId: "outdoor", Message: "failed", Time: now},
+		{Type: config.EventCameraOutage, CameraId: "garage", Message: "down", Time: now},
+		{Type: config.EventDiskAlmostFull, Message: "full", Time: now},
+	} {
+		if err := e.Notify(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is sent until the digest is flushed
+	select {
+	case <-mails:
+		t.Fatal("expected the events to wait for the digest")
+	default:
+	}
+
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The garage has its own recipients
+	first, second := <-mails, <-mails
+	if !slices.Equal(first.to, []string{"admin@example.com", "security@example.com"}) {
+		t.Errorf("unexpected recipients %v", first.to)
+	}
+	if !slices.Equal(second.to, []string{"garage@example.com"}) {
+		t.Errorf("unexpected recipients of the garage %v", second.to)
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(first.message.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "[Vigilis] 2 events" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+
+	_, params, err := mime.ParseMediaType(first.message.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := multipart.NewReader(first.message.Body, params["boundary"])
+
+	text, err := reader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(text)
+	if !strings.Contains(string(body), "Outdoor (outdoor) - recorder failed") || !strings.Contains(string(body), "disk almost full") {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	attachment, err := reader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	picture, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	if attachment.Header.Get("Content-Type") != "image/jpeg" || string(picture) != "jpeg of outdoor" {
+		t.Errorf("unexpected attachment %v %q", attachment.Header, picture)
+	}
+
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Error("expected a single picture, the disk event has no camera")
+	}
+}
+
+func TestEmailRetryable(t *testing.T) {
+	if retryable(&textproto.Error{Code: 550, Msg: "mailbox unavailable"}) {
+		t.Error("expected permanent failures to not be retried")
+	}
+	if !retryable(&textproto.Error{Code: 451, Msg: "try again later"}) {
+		t.Error("expected temporary failures to be retried")
+	}
+	if !retryable(&net.OpError{Op: "dial", Err: io.EOF}) {
+		t.Error("expected network errors to be retried")
+	}
+}
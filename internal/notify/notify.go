@@ -0,0 +1,209 @@
+package notify
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/logger"
+)
+
+// QueueSize is how many events can be waiting to be sent by each notifier, newer events are dropped
+const QueueSize = 100
+
+// StopTimeout is how long to wait for the queued events to be sent when stopping
+const StopTimeout = 10 * time.Second
+
+// Event is something that happened to a camera or to vigilis
+type Event struct {
+	Type     string    `json:"type"` // One of config.Events
+	CameraId string    `json:"camera_id,omitempty"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+// Notifier sends events to an external service
+type Notifier interface {
+	Name() string
+	Wants(event Event) bool
+	Notify(ctx context.Context, event Event) error
+}
+
+// flusher is a notifier that groups the events, sending them every FlushInterval
+type flusher interface {
+	FlushInterval() time.Duration // Zero when the events are sent right away
+	Flush(ctx context.Context) error
+}
+
+// queue sends the events to a notifier in the background, in order
+type queue struct {
+	notifier Notifier
+	events   chan Event
+	done     chan struct{} // Closed once the queued events were sent
+	stopping chan struct{} // Closed to abort sending
+}
+
+var (
+	mu        sync.Mutex
+	queues    []*queue
+	listeners []func(Event) // Receive every event, they are kept when the notifiers are replaced
+)
+
+// Setup replaces the notifiers with the ones in the config
+func Setup(notifications *config.Notifications) {
+	var notifiers []Notifier
+	if notifications != nil {
+		for _, webhook := range notifications.Webhooks {
+			notifiers = append(notifiers, newWebhook(webhook))
+		}
+		if notifications.Email != nil {
+			notifiers = append(notifiers, newEmail(notifications.Email))
+		}
+	}
+
+	newQueues := make([]*queue, 0, len(notifiers))
+	for _, notifier := range notifiers {
+		q := &queue{
+			notifier: notifier,
+			events:   make(chan Event, QueueSize),
+			done:     make(chan struct{}),
+			stopping: make(chan struct{}),
+		}
+		go q.run()
+
+		newQueues = append(newQueues, q)
+	}
+
+	mu.Lock()
+	previous := queues
+	queues = newQueues
+	mu.Unlock()
+
+	// The previous notifiers send what was already queued
+	go stopQueues(previous)
+
+	if len(newQueues) > 0 {
+		logger.Trace("%d notifier(s) configured", len(newQueues))
+	}
+}
+
+// Listen calls the function with every event sent, from the goroutine of the sender so it must not block
+func Listen(listener func(Event)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	listeners = append(listeners, listener)
+}
+
+// Send queues the event to the notifiers that want it
+func Send(eventType string, cameraId string, message string) {
+	event := Event{
+		Type:     eventType,
+		CameraId: cameraId,
+		Message:  message,
+		Time:     time.Now(),
+	}
+
+	mu.Lock()
+	eventListeners := slices.Clone(listeners)
+	for _, q := range queues {
+		if !q.notifier.Wants(event) {
+			continue
+		}
+
+		select {
+		case q.events <- event:
+		default:
+			logger.Warn("Notifier %v is not keeping up, dropping %v event", q.notifier.Name(), event.Type)
+		}
+	}
+	mu.Unlock()
+
+	// Without the lock, so a slow listener doesn't block the other senders
+	for _, listener := range eventListeners {
+		listener(event)
+	}
+}
+
+// Stop sends the queued events and stops the notifiers
+func Stop() {
+	mu.Lock()
+	previous := queues
+	queues = nil
+	mu.Unlock()
+
+	stopQueues(previous)
+}
+
+// stopQueues waits for the queues to send their events, aborting after StopTimeout
+func stopQueues(stopped []*queue) {
+	for _, q := range stopped {
+		close(q.events)
+	}
+
+	timeout := time.After(StopTimeout)
+	for _, q := range stopped {
+		select {
+		case <-q.done:
+		case <-timeout:
+			for _, q := range stopped {
+				close(q.stopping)
+			}
+			logger.Warn("Some notifications were not sent before the timeout")
+			return
+		}
+	}
+}
+
+func (q *queue) run() {
+	defer close(q.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-q.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var flush <-chan time.Time
+	f, flushes := q.notifier.(flusher)
+	if flushes && f.FlushInterval() > 0 {
+		ticker := time.NewTicker(f.FlushInterval())
+		defer ticker.Stop()
+		flush = ticker.C
+	} else {
+		flushes = false
+	}
+
+	for {
+		select {
+		case event, ok := <-q.events:
+			if !ok {
+				// Send what is left before stopping
+				if flushes {
+					q.flush(ctx, f)
+				}
+				return
+			}
+
+			err := q.notifier.Notify(ctx, event)
+			if err != nil {
+				logger.Error("Unable to send %v event to %v: %v", event.Type, q.notifier.Name(), err)
+			}
+		case <-flush:
+			q.flush(ctx, f)
+		}
+	}
+}
+
+func (q *queue) flush(ctx context.Context, f flusher) {
+	err := f.Flush(ctx)
+	if err != nil {
+		logger.Error("Unable to send the events to %v: %v", q.notifier.Name(), err)
+	}
+}
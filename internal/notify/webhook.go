@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/logger"
+)
+
+const (
+	WebhookTimeout    = 10 * time.Second // Timeout of each request
+	WebhookAttempts   = 5                // Requests made before giving up on an event
+	WebhookRetryDelay = 2 * time.Second  // Delay before the first retry, doubled on each retry
+)
+
+// SignatureHeader has the HMAC-SHA256 of the body, hex encoded and prefixed with sha256=
+const SignatureHeader = "X-Vigilis-Signature"
+
+type webhook struct {
+	config *config.Webhook
+	client *http.Client
+}
+
+func newWebhook(webhookConfig *config.Webhook) *webhook {
+	return &webhook{
+		config: webhookConfig,
+		client: &http.Client{Timeout: WebhookTimeout},
+	}
+}
+
+// Name returns the webhook URL without credentials
+func (w *webhook) Name() string {
+	parsed, err := url.Parse(w.config.Url)
+	if err != nil {
+		return "webhook"
+	}
+
+	return "webhook " + parsed.Redacted()
+}
+
+func (w *webhook) Wants(event Event) bool {
+	return w.config.Wants(event.Type)
+}
+
+// Notify posts the event as JSON, retrying when the request fails
+func (w *webhook) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	delay := WebhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := w.post(ctx, body, event)
+		if err == nil || !retry || attempt == WebhookAttempts {
+			return err
+		}
+
+		logger.Warn("Error sending %v event to %v, retrying in %v: %v", event.Type, w.Name(), delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// post makes a request, returning if it should be retried when it fails
+func (w *webhook) post(ctx context.Context, body []byte, event Event) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Vigilis")
+	request.Header.Set("X-Vigilis-Event", event.Type)
+	if w.config.Secret != "" {
+		request.Header.Set(SignatureHeader, "sha256="+Sign(w.config.Secret, body))
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+
+	// Client errors won't be fixed by retrying, except for rate limits
+	retry := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected response status %v", response.Status)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the body, used to verify the requests came from vigilis
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+)
+
+func TestWebhookNotify(t *testing.T) {
+	const secret = "secret"
+
+	var requests int
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if signature := r.Header.Get(SignatureHeader); signature != "sha256="+Sign(secret, body) {
+			t.Errorf("unexpected signature %q", signature)
+		}
+		if eventType := r.Header.Get("X-Vigilis-Event"); eventType != config.EventStallDetected {
+			t.Errorf("unexpected event header %q", eventType)
+		}
+
+		// The first request fails and is retried
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	hook := newWebhook(&config.Webhook{Url: server.URL, Secret: secret})
+	event := Event{Type: config.EventStallDetected, CameraId: "a", Message: "stalled", Time: time.Now()}
+
+	err := hook.Notify(context.Background(), event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	if received.Type != event.Type || received.CameraId != "a" || received.Message != "stalled" {
+		t.Errorf("unexpected event %+v", received)
+	}
+}
+
+func TestWebhookNotRetried(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	hook := newWebhook(&config.Webhook{Url: server.URL, Events: []string{config.EventPurgeError}})
+	if hook.Wants(Event{Type: config.EventStallDetected}) {
+		t.Error("expected the webhook to only want purge errors")
+	}
+
+	err := hook.Notify(context.Background(), Event{Type: config.EventPurgeError})
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if requests != 1 {
+		t.Errorf("expected client errors to not be retried, got %d requests", requests)
+	}
+}
@@ -0,0 +1,69 @@
+package recorders
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	RestartMinDelay = time.Second // Delay after the second consecutive failure, the first restart is immediate
+	RestartMaxDelay = time.Minute
+	RestartJitter   = 0.2 // Fraction of the delay that is randomized
+
+	HealthyRunTime        = time.Minute      // Processes running for longer reset the backoff
+	MaxRestartAttempts    = 10               // Failed attempts within FailureWindow before the recorder is marked as failed
+	FailureWindow         = 10 * time.Minute // Failures older than this don't count towards MaxRestartAttempts
+	RecoveryProbeInterval = 5 * time.Minute  // How often failed recorders try to start again
+)
+
+// restartState tracks the consecutive failures of a recorder
+type restartState struct {
+	attempts     int       // Failed attempts in the current window
+	firstFailure time.Time // Start of the current failure window
+	failed       bool      // Set when MaxRestartAttempts is reached, until the recorder runs healthily again
+}
+
+// failure records a failed attempt and returns how long to wait before the next one
+func (s *restartState) failure(now time.Time) time.Duration {
+	if s.failed {
+		return RecoveryProbeInterval
+	}
+
+	// Start a new window when the previous one expired
+	if s.attempts == 0 || now.Sub(s.firstFailure) > FailureWindow {
+		s.attempts = 0
+		s.firstFailure = now
+	}
+
+	s.attempts++
+	if s.attempts > MaxRestartAttempts {
+		s.failed = true
+		return RecoveryProbeInterval
+	}
+
+	return backoffDelay(s.attempts)
+}
+
+// success resets the state, returning true if the recorder was marked as failed
+func (s *restartState) success() bool {
+	recovered := s.failed
+	*s = restartState{}
+
+	return recovered
+}
+
+// backoffDelay returns the exponential delay with jitter for the given attempt
+func backoffDelay(attempt int) time.Duration {
+	// Restart right away the first time to avoid losing footage
+	if attempt <= 1 {
+		return 0
+	}
+
+	delay := RestartMaxDelay
+	if shift := attempt - 2; shift < 32 {
+		delay = min(RestartMinDelay<<shift, RestartMaxDelay)
+	}
+
+	jitter := (rand.Float64()*2 - 1) * RestartJitter * float64(delay)
+	return delay + time.Duration(jitter)
+}
@@ -0,0 +1,67 @@
+package recorders
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	cases := []struct {
+		Attempt  int
+		Expected time.Duration
+	}{
+		{Attempt: 1, Expected: 0},
+		{Attempt: 2, Expected: RestartMinDelay},
+		{Attempt: 3, Expected: 2 * RestartMinDelay},
+		{Attempt: 4, Expected: 4 * RestartMinDelay},
+		{Attempt: 10, Expected: RestartMaxDelay},
+		{Attempt: 100, Expected: RestartMaxDelay},
+	}
+
+	for _, caseData := range cases {
+		delay := backoffDelay(caseData.Attempt)
+
+		jitter := time.Duration(RestartJitter * float64(caseData.Expected))
+		if delay < caseData.Expected-jitter || delay > caseData.Expected+jitter {
+			t.Errorf("attempt %d: wanted %v ± %v, got %v", caseData.Attempt, caseData.Expected, jitter, delay)
+		}
+	}
+}
+
+func TestRestartStateFailure(t *testing.T) {
+	var s restartState
+	now := time.Now()
+
+	for i := 1; i <= MaxRestartAttempts; i++ {
+		s.failure(now)
+		if s.failed {
+			t.Fatalf("marked as failed after %d attempts", i)
+		}
+	}
+
+	if delay := s.failure(now); !s.failed || delay != RecoveryProbeInterval {
+		t.Errorf("not marked as failed after %d attempts", MaxRestartAttempts+1)
+	}
+
+	if !s.success() {
+		t.Error("success didn't report the recovery")
+	}
+	if s.failed || s.attempts != 0 {
+		t.Error("success didn't reset the state")
+	}
+}
+
+func TestRestartStateWindow(t *testing.T) {
+	var s restartState
+	now := time.Now()
+
+	for range MaxRestartAttempts {
+		s.failure(now)
+	}
+
+	// Failures outside the window start a new one
+	s.failure(now.Add(FailureWindow + time.Second))
+	if s.failed || s.attempts != 1 {
+		t.Errorf("expected a new window, got %d attempts (failed: %v)", s.attempts, s.failed)
+	}
+}
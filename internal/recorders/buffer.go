@@ -0,0 +1,217 @@
+package recorders
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/files"
+	"vigilis/internal/logger"
+)
+
+var ErrNotEventRecording = errors.New("the camera doesn't use the events record")
+
+// eventBuffer promotes the buffered recordings of a camera with the events record around its triggers
+type eventBuffer struct {
+	camera *config.Camera
+
+	mu            sync.Mutex
+	until         time.Time           // Recordings started before this are promoted, zero before the first trigger
+	motion        bool                // Ongoing motion promotes the recordings until it ends
+	segments      []bufferedSegment   // Completed recordings that were not promoted, oldest first
+	pendingMotion []files.MotionEvent // Stored once the recordings of the motion are promoted
+}
+
+// bufferedSegment is a completed recording in the buffer
+type bufferedSegment struct {
+	name     string // Path relative to the buffer directory, and to the camera directory once promoted
+	start    time.Time
+	duration time.Duration
+}
+
+func (s bufferedSegment) end() time.Time {
+	return s.start.Add(s.duration)
+}
+
+func newEventBuffer(camera *config.Camera) *eventBuffer {
+	return &eventBuffer{camera: camera}
+}
+
+// trigger keeps the recordings from the pre-roll before now to the post-roll after it, returning until when
+func (b *eventBuffer) trigger(now time.Time) time.Time {
+	b.mu.Lock()
+	events := b.camera.EventRecording
+	b.extend(now.Add(events.PostRoll))
+	until := b.until
+
+	// The recordings of the pre-roll were already completed, they're promoted without holding the lock
+	preRoll := now.Add(-events.PreRoll)
+	var promoted []bufferedSegment
+	b.segments = slices.DeleteFunc(b.segments, func(segment bufferedSegment) bool {
+		if segment.end().Before(preRoll) {
+			return false
+		}
+		promoted = append(promoted, segment)
+		return true
+	})
+	b.mu.Unlock()
+
+	for _, segment := range promoted {
+		if !b.promote(segment) {
+			b.keep(segment)
+		}
+	}
+
+	return until
+}
+
+// keep puts back a recording that couldn't be promoted in the buffer, a later trigger may promote it
+func (b *eventBuffer) keep(segment bufferedSegment) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.segments = append(b.segments, segment)
+	slices.SortFunc(b.segments, func(a, b bufferedSegment) int {
+		return a.start.Compare(b.start)
+	})
+}
+
+// extend promotes the recordings started until the given time
+func (b *eventBuffer) extend(until time.Time) {
+	if until.After(b.until) {
+		b.until = until
+	}
+}
+
+// motionStarted promotes the recordings while the motion lasts
+func (b *eventBuffer) motionStarted(now time.Time) time.Time {
+	b.mu.Lock()
+	b.motion = true
+	b.mu.Unlock()
+
+	return b.trigger(now)
+}
+
+// motionEnded keeps the post-roll after the motion, the event is stored once its recordings are promoted
+func (b *eventBuffer) motionEnded(event files.MotionEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.motion = false
+	b.extend(event.End.Add(b.camera.EventRecording.PostRoll))
+	b.pendingMotion = append(b.pendingMotion, event)
+}
+
+// completed promotes the recording if it's covered by a trigger, or keeps it in the buffer for the pre-roll
+func (b *eventBuffer) completed(name string, duration time.Duration) {
+	start, err := files.ParseSegmentStart(name)
+	if err != nil {
+		logger.Warn("%v recorder > Unexpected name of the buffered segment %v: %v", b.camera.Id, name, err)
+		return
+	}
+	segment := bufferedSegment{name: name, start: start, duration: duration}
+
+	// The recordings are promoted, and the motion events stored, without holding the lock
+	b.mu.Lock()
+	promote := b.motion || !start.After(b.until)
+	if !promote {
+		b.segments = append(b.segments, segment)
+	}
+	b.mu.Unlock()
+
+	if promote && !b.promote(segment) {
+		b.keep(segment)
+	}
+
+	// The motion events are stored once the recording where they ended is completed
+	var completedMotion []files.MotionEvent
+	b.mu.Lock()
+	b.pendingMotion = slices.DeleteFunc(b.pendingMotion, func(event files.MotionEvent) bool {
+		if event.End.After(segment.end()) {
+			return false
+		}
+		completedMotion = append(completedMotion, event)
+		return true
+	})
+
+	// Older recordings can't be promoted by a trigger anymore
+	now := time.Now()
+	preRoll := now.Add(-b.camera.EventRecording.PreRoll)
+	b.segments = slices.DeleteFunc(b.segments, func(segment bufferedSegment) bool {
+		return segment.end().Before(preRoll)
+	})
+	b.mu.Unlock()
+
+	for _, event := range completedMotion {
+		b.storeMotion(event)
+	}
+
+	// The recordings may be longer than the segment length, to start with a keyframe
+	segmentLength := time.Duration(b.camera.SegmentSeconds) * time.Second
+	files.PurgeBuffer(b.camera, preRoll.Add(-2*segmentLength))
+}
+
+// promote moves the recording to the camera directory, returning if it succeeded
+func (b *eventBuffer) promote(segment bufferedSegment) bool {
+	err := files.PromoteSegment(b.camera, segment.name, segment.duration)
+	if err != nil {
+		logger.Warn("%v recorder > Error promoting the buffered segment %v: %v", b.camera.Id, segment.name, err)
+		return false
+	}
+
+	logger.Trace("%v recorder > Segment %v promoted and indexed", b.camera.Id, segment.name)
+	return true
+}
+
+// flushMotion stores the motion events that are still pending, once the process exited
+func (b *eventBuffer) flushMotion() {
+	b.mu.Lock()
+	pending := b.pendingMotion
+	b.pendingMotion = nil
+	b.mu.Unlock()
+
+	for _, event := range pending {
+		b.storeMotion(event)
+	}
+}
+
+func (b *eventBuffer) storeMotion(event files.MotionEvent) {
+	err := files.RecordMotion(b.camera, event)
+	if err != nil {
+		logger.Warn("%v recorder > Error storing the motion event: %v", b.camera.Id, err)
+	}
+}
+
+// triggeredUntil returns until when the recordings are promoted, zero if there is no trigger
+func (b *eventBuffer) triggeredUntil(now time.Time) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.motion {
+		return now.Add(b.camera.EventRecording.PostRoll)
+	}
+	if b.until.Before(now) {
+		return time.Time{}
+	}
+
+	return b.until
+}
+
+// Trigger keeps the recordings of the camera around now, from the pre-roll before to the post-roll after.
+// It returns until when the recordings are kept.
+func Trigger(cameraId string, source string) (time.Time, error) {
+	recorder := orchestrator.find(cameraId)
+	if recorder == nil {
+		return time.Time{}, ErrCameraNotFound
+	}
+	if recorder.buffer == nil {
+		return time.Time{}, ErrNotEventRecording
+	}
+
+	until := recorder.buffer.trigger(time.Now())
+	logger.Info("%v recorder > Triggered by %v, keeping the recordings until %v",
+		cameraId, source, until.Local().Format(time.TimeOnly))
+
+	return until, nil
+}
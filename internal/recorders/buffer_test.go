@@ -0,0 +1,122 @@
+package recorders
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/files"
+	"vigilis/internal/util"
+)
+
+func TestEventBuffer(t *testing.T) {
+	camera := &config.Camera{
+		Id:             "a",
+		SegmentSeconds: 10,
+		Record:         config.RecordEvents,
+		EventRecording: &config.EventRecording{PreRoll: 10 * time.Second, PostRoll: 30 * time.Second},
+	}
+	config.Apply(&config.VigilisConfig{
+		Storage: &config.Storage{Path: t.TempDir(), RetentionDays: 7, PathTemplate: config.DefaultPathTemplate},
+		Cameras: []*config.Camera{camera},
+	})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+	}()
+
+	now := time.Now().Truncate(time.Second)
+	b := newEventBuffer(camera)
+
+	// Writes a segment to the buffer as ffmpeg would, and completes it
+	record := func(start time.Time) string {
+		name := util.Strftime(config.Current().Storage.SegmentPattern(), start)
+		if err := os.MkdirAll(files.BufferDir(camera), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(files.BufferDir(camera), name), []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		b.completed(name, 10*time.Second)
+		return name
+	}
+
+	old := record(now.Add(-60 * time.Second))
+	beforePreRoll := record(now.Add(-25 * time.Second))
+	preRoll := record(now.Add(-15 * time.Second))
+
+	// Only the recordings of the pre-roll are promoted
+	until := b.trigger(now)
+	if !until.Equal(now.Add(30 * time.Second)) {
+		t.Errorf("expected the recordings to be kept until %v, got %v", now.Add(30*time.Second), until)
+	}
+
+	postRoll := record(now)
+	afterPostRoll := record(now.Add(40 * time.Second))
+
+	cases := []struct {
+		name     string
+		promoted bool
+		buffered bool
+	}{
+		{old, false, false}, // Purged
+		{beforePreRoll, false, true},
+		{preRoll, true, false},
+		{postRoll, true, false},
+		{afterPostRoll, false, true},
+	}
+	for _, c := range cases {
+		_, err := os.Stat(path.Join(files.CameraDir(camera), c.name))
+		if promoted := err == nil; promoted != c.promoted {
+			t.Errorf("%v: wanted promoted %v, got %v", c.name, c.promoted, promoted)
+		}
+
+		_, err = os.Stat(path.Join(files.BufferDir(camera), c.name))
+		if buffered := err == nil; buffered != c.buffered {
+			t.Errorf("%v: wanted buffered %v, got %v", c.name, c.buffered, buffered)
+		}
+	}
+}
+
+func TestEventBufferKeepsFailedPromotions(t *testing.T) {
+	camera := &config.Camera{
+		Id:             "a",
+		SegmentSeconds: 10,
+		Record:         config.RecordEvents,
+		EventRecording: &config.EventRecording{PreRoll: 10 * time.Second, PostRoll: 30 * time.Second},
+	}
+	root := t.TempDir()
+	config.Apply(&config.VigilisConfig{
+		Storage: &config.Storage{Path: root, RetentionDays: 7, PathTemplate: config.DefaultPathTemplate},
+		Cameras: []*config.Camera{camera},
+	})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+	}()
+
+	// The camera directory can't be created, so the recordings can't be promoted
+	if err := os.WriteFile(files.CameraDir(camera), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	b := newEventBuffer(camera)
+	b.trigger(now)
+
+	name := util.Strftime(config.Current().Storage.SegmentPattern(), now)
+	if err := os.MkdirAll(files.BufferDir(camera), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(files.BufferDir(camera), name), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b.completed(name, 10*time.Second)
+
+	if len(b.segments) != 1 || b.segments[0].name != name {
+		t.Errorf("expected the recording to be kept in the buffer, got %v", b.segments)
+	}
+	if _, err := os.Stat(path.Join(files.BufferDir(camera), name)); err != nil {
+		t.Errorf("expected the recording to stay buffered: %v", err)
+	}
+}
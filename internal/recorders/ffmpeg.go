@@ -1,24 +1,34 @@
 package recorders
 
 import (
+	"fmt"
 	"os/exec"
 	"path"
 	"regexp"
 	"slices"
 	"strconv"
+	"strings"
+	"time"
 	"vigilis/internal/config"
 	"vigilis/internal/logger"
+	"vigilis/internal/notify"
 )
 
-const RecordingLengthMinutes = 10
-
 type RecordMode int
 
 const (
-	RecordModeDirect RecordMode = iota
-	//RecordMode2
+	RecordModeDirect    RecordMode = iota // Copy the audio and video streams
+	RecordModeVideoOnly                   // Copy the video stream, drop the audio
+	RecordModeReencode                    // Re-encode the video stream to H.264
 )
 
+// recordModes maps the record modes in the config to the ones used by the recorder
+var recordModes = map[string]RecordMode{
+	config.RecordModeDirect:    RecordModeDirect,
+	config.RecordModeVideoOnly: RecordModeVideoOnly,
+	config.RecordModeReencode:  RecordModeReencode,
+}
+
 type (
 	FfmpegConfig struct {
 		Path string
@@ -27,35 +37,91 @@ type (
 
 type cmdArgs = []string
 
-const Filename = "%Y%m%d-%H%M%S.mkv"
+// globalArgs are followed by the input arguments from the camera config,
+// which default to config.DefaultInputArgs
+// See https://medium.com/@tom.humph/saving-rtsp-camera-streams-with-ffmpeg-baab7e80d767
+var globalArgs = cmdArgs{
+	"-hide_banner", "-y",
+	"-loglevel", "error",
+}
 
+// recordArgs are the codec arguments of each record mode
 var recordArgs = map[RecordMode]cmdArgs{
-	// See https://medium.com/@tom.humph/saving-rtsp-camera-streams-with-ffmpeg-baab7e80d767
 	RecordModeDirect: cmdArgs{
-		"-hide_banner", "-y",
-		"-loglevel", "error",
-		"-rtsp_transport", "tcp",
-		"-use_wallclock_as_timestamps", "1",
 		"-vcodec", "copy",
 		"-acodec", "copy",
-		"-f", "segment",
-		"-reset_timestamps", "1",
-		"-segment_time", "" + strconv.Itoa(60*RecordingLengthMinutes), // in seconds
-		"-segment_atclocktime", "1", // minute to start a new segment
-		"-segment_format", "mkv",
-		"-strftime", "1",
 	},
+	RecordModeVideoOnly: cmdArgs{
+		"-vcodec", "copy",
+		"-an",
+	},
+	// The CRF and preset are appended from the camera config
+	RecordModeReencode: cmdArgs{
+		"-vcodec", "libx264",
+		"-pix_fmt", "yuv420p",
+		"-acodec", "copy",
+	},
+}
+
+// segmentArgs split the recording into files, the length comes from the camera config
+var segmentArgs = cmdArgs{
+	"-f", "segment",
+	"-reset_timestamps", "1",
+	"-segment_atclocktime", "1", // minute to start a new segment
+	"-segment_format", "mkv",
+	"-strftime", "1",
+}
+
+// liveArgs are the codec arguments of the live view output of the record modes that copy the video.
+// The audio is dropped as most camera codecs are not supported by HLS players.
+var liveArgs = map[RecordMode]cmdArgs{
+	RecordModeDirect: cmdArgs{
+		"-vcodec", "copy",
+		"-an",
+	},
+	RecordModeVideoOnly: cmdArgs{
+		"-vcodec", "copy",
+		"-an",
+	},
+}
+
+// LivePlaylist is the name of the HLS playlist in the live directory of each camera
+const LivePlaylist = "index.m3u8"
+
+// hlsArgs write a rolling HLS playlist, the segment length and list size come from the config
+var hlsArgs = cmdArgs{
+	"-f", "hls",
+	"-hls_flags", "delete_segments+omit_endlist",
+}
+
+// teeArgs write the re-encoded video to the recordings and the live view with the tee muxer,
+// so it's only encoded once. The encoder headers are global for the Matroska recordings.
+var teeArgs = cmdArgs{
+	"-flags", "+global_header",
+	"-f", "tee",
+}
+
+// teeLiveArgs are the options of the live view output of the tee muxer, added to hlsArgs.
+// The audio is dropped as with liveArgs, and the encoder headers are repeated on keyframes for the HLS players.
+var teeLiveArgs = cmdArgs{
+	"-select", "v",
+	"-bsfs/v", "dump_extra=freq=keyframe",
 }
 
 var Ffmpeg FfmpegConfig
 
 func CheckFfmpeg() {
-	path := config.Vigilis.Recorder.FfmpegPath
+	path := config.Current().Recorder.FfmpegPath
 
 	// Check if the path is valid
 	fullPath, err := exec.LookPath(path)
 	if err != nil {
 		logger.Error("ffmpeg not found: %v", err)
+
+		// Send the notification before exiting
+		notify.Send(config.EventFfmpegMissing, "", "ffmpeg not found: "+err.Error())
+		notify.Stop()
+
 		logger.Fatal("Make sure you have ffmpeg installed or provide a valid path in the config")
 		return
 	}
@@ -86,17 +152,177 @@ func FfmpegVersion() string {
 	return verResult[1] // 0 is the match, 1 is the version group
 }
 
-func BuildCommand(r Recorder) (string, []string) {
-	// TODO Add the record mode to the camera config
-	// TODO Add custom args to the camera config
-	args := recordArgs[RecordModeDirect]
+func BuildCommand(r *Recorder) (string, []string) {
+	camera := r.Camera
+	mode := recordModes[camera.RecordMode]
+
+	args := recordArgs[mode]
+	if mode == RecordModeReencode {
+		args = slices.Concat(args, encoderArgs(camera))
+	}
+
+	outputPath := path.Join(r.OutputDir, r.pattern)
+	recordingArgs := slices.Concat(
+		segmentArgs,
+		segmentListArgs,
+		[]string{"-segment_time", strconv.Itoa(camera.SegmentSeconds)}, // in seconds
+	)
 
-	outputPath := path.Join(r.OutputDir, Filename)
+	// The live view shares the encoded video instead of encoding it a second time
+	if mode == RecordModeReencode && r.LiveDir != "" {
+		return Ffmpeg.Path,
+			slices.Concat(
+				globalArgs,
+				camera.InputArgs,
+				[]string{"-i", camera.StreamUrl},
+				args,
+				camera.OutputArgs,
+				teeArgs,
+				[]string{teeOutput(recordingArgs, outputPath) + "|" +
+					teeOutput(slices.Concat(hlsArgs, teeLiveArgs, liveHlsArgs()), livePlaylist(r))},
+				buildMotionArgs(camera),
+			)
+	}
 
 	return Ffmpeg.Path,
 		slices.Concat(
-			[]string{"-i", r.Camera.StreamUrl},
+			globalArgs,
+			camera.InputArgs,
+			[]string{"-i", camera.StreamUrl},
 			args,
+			camera.OutputArgs,
+			recordingArgs,
 			[]string{outputPath},
+			buildLiveArgs(r, mode),
+			buildMotionArgs(camera),
+		)
+}
+
+// buildLiveArgs builds the second output of the recording process, the live view
+func buildLiveArgs(r *Recorder, mode RecordMode) []string {
+	if r.LiveDir == "" {
+		return nil
+	}
+
+	return slices.Concat(
+		liveArgs[mode],
+		hlsArgs,
+		liveHlsArgs(),
+		[]string{livePlaylist(r)},
+	)
+}
+
+// liveHlsArgs are the segment length and list size of the live view from the config
+func liveHlsArgs() []string {
+	live := config.Current().Live
+
+	return []string{
+		"-hls_time", strconv.Itoa(live.SegmentSeconds),
+		"-hls_list_size", strconv.Itoa(live.ListSize),
+	}
+}
+
+func livePlaylist(r *Recorder) string {
+	return path.Join(r.LiveDir, LivePlaylist)
+}
+
+// teeOutput builds an output of the tee muxer from the muxer arguments, which are pairs of options and values.
+// The values are unescaped twice by ffmpeg, as options and as outputs of the list.
+func teeOutput(args cmdArgs, output string) string {
+	options := make([]string, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		options = append(options, strings.TrimPrefix(args[i], "-")+"="+escapeTee(args[i+1], ":]"))
+	}
+
+	return escapeTee("["+strings.Join(options, ":")+"]"+output, "|")
+}
+
+// escapeTee escapes the backslashes, the quotes and the delimiters of an ffmpeg token
+func escapeTee(token string, delimiters string) string {
+	var escaped strings.Builder
+	for _, c := range token {
+		if strings.ContainsRune(`\'`+delimiters, c) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(c)
+	}
+
+	return escaped.String()
+}
+
+// encoderArgs are the H.264 encoder settings of the camera
+func encoderArgs(camera *config.Camera) []string {
+	return []string{
+		"-crf", strconv.Itoa(camera.Encoder.Crf),
+		"-preset", camera.Encoder.Preset,
+	}
+}
+
+// remuxArgs convert a recording to fragmented MP4 so it can be streamed to browsers
+var remuxArgs = cmdArgs{
+	"-vcodec", "copy",
+	"-acodec", "aac", // Camera audio codecs like G.711 are not supported by MP4
+	"-f", "mp4",
+	"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+}
+
+// BuildRemuxCommand builds the command that writes the recording as fragmented MP4 to stdout
+func BuildRemuxCommand(recordingPath string) (string, []string) {
+	return Ffmpeg.Path,
+		slices.Concat(
+			globalArgs,
+			[]string{"-i", recordingPath},
+			remuxArgs,
+			[]string{"pipe:1"},
+		)
+}
+
+// exportFormats are the muxers of the export formats
+var exportFormats = map[string]string{
+	"mp4": "mp4",
+	"mkv": "matroska",
+}
+
+// exportOverlay burns the recording time in the top left corner, from the given Unix time
+const exportOverlay = `drawtext=text='%%{pts\:localtime\:%d}':x=10:y=10:fontsize=24:fontcolor=white:box=1:boxcolor=black@0.5`
+
+// BuildExportCommand builds the command that concatenates and trims the recordings of the concat list.
+// The recording time is burned in when overlayStart is not zero, which requires re-encoding the video.
+// The output is a file path or pipe:1, where MP4 is written fragmented.
+func BuildExportCommand(camera *config.Camera, listPath string, format string, overlayStart time.Time, output string) (string, []string) {
+	args := cmdArgs{"-vcodec", "copy"}
+	if !overlayStart.IsZero() {
+		args = slices.Concat(
+			cmdArgs{"-vcodec", "libx264", "-pix_fmt", "yuv420p"},
+			encoderArgs(camera),
+			cmdArgs{"-vf", fmt.Sprintf(exportOverlay, overlayStart.Unix())},
+		)
+	}
+
+	switch format {
+	case "mp4":
+		args = slices.Concat(args, cmdArgs{"-acodec", "aac"}) // Camera audio codecs like G.711 are not supported by MP4
+		if output == "pipe:1" {
+			args = slices.Concat(args, cmdArgs{"-movflags", "frag_keyframe+empty_moov+default_base_moof"})
+		} else {
+			args = slices.Concat(args, cmdArgs{"-movflags", "+faststart"})
+		}
+	default:
+		args = slices.Concat(args, cmdArgs{"-acodec", "copy"})
+	}
+
+	return Ffmpeg.Path,
+		slices.Concat(
+			globalArgs,
+			[]string{"-f", "concat", "-safe", "0", "-i", listPath},
+			args,
+			[]string{"-avoid_negative_ts", "make_zero"}, // Stream copy starts at the keyframe before the in point
+			[]string{"-f", exportFormats[format], output},
 		)
 }
+
+// ExportFormatSupported checks if the clips can be exported in the given format
+func ExportFormatSupported(format string) bool {
+	_, ok := exportFormats[format]
+	return ok
+}
@@ -0,0 +1,83 @@
+package recorders
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"vigilis/internal/config"
+)
+
+func TestBuildCommandLiveReencode(t *testing.T) {
+	config.Apply(&config.VigilisConfig{Live: &config.Live{Path: "/live", SegmentSeconds: 2, ListSize: 5}})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+	}()
+
+	r := &Recorder{
+		Camera: &config.Camera{
+			Id:             "a",
+			StreamUrl:      "rtsp://a",
+			RecordMode:     config.RecordModeReencode,
+			Encoder:        &config.Encoder{Crf: 23, Preset: "veryfast"},
+			SegmentSeconds: 60,
+		},
+		OutputDir: "/recordings/a|b",
+		LiveDir:   "/live/a",
+		pattern:   "%Y%m%d-%H%M%S.mkv",
+	}
+
+	// The video is encoded once, for both outputs of the tee muxer
+	_, args := BuildCommand(r)
+	expected := slices.Concat(
+		globalArgs,
+		[]string{
+			"-i", "rtsp://a",
+			"-vcodec", "libx264", "-pix_fmt", "yuv420p", "-acodec", "copy", "-crf", "23", "-preset", "veryfast",
+			"-flags", "+global_header", "-f", "tee",
+			`[f=segment:reset_timestamps=1:segment_atclocktime=1:segment_format=mkv:strftime=1:` +
+				`segment_list=pipe\\:1:segment_list_type=csv:segment_time=60]/recordings/a\|b/%Y%m%d-%H%M%S.mkv` +
+				`|[f=hls:hls_flags=delete_segments+omit_endlist:select=v:bsfs/v=dump_extra=freq=keyframe:` +
+				`hls_time=2:hls_list_size=5]/live/a/index.m3u8`,
+		},
+	)
+	if !slices.Equal(args, expected) {
+		t.Errorf("wanted %q, got %q", expected, args)
+	}
+
+	// Without the live view the recordings are written directly
+	r.LiveDir = ""
+	_, args = BuildCommand(r)
+	if slices.Contains(args, "tee") || args[len(args)-1] != "/recordings/a|b/%Y%m%d-%H%M%S.mkv" {
+		t.Errorf("expected a single segment output, got %q", args)
+	}
+}
+
+func TestBuildCommandMotion(t *testing.T) {
+	config.Apply(&config.VigilisConfig{Live: &config.Live{Path: "/live", SegmentSeconds: 2, ListSize: 5}})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+	}()
+
+	camera := &config.Camera{
+		Id:             "a",
+		StreamUrl:      "rtsp://a",
+		Encoder:        &config.Encoder{Crf: 23, Preset: "veryfast"},
+		SegmentSeconds: 60,
+		Motion:         &config.Motion{Fps: 2, Width: 320, Height: 180},
+	}
+	expected := []string{"-an", "-vf", "fps=2,scale=320:180,format=gray", "-f", "rawvideo", "-pix_fmt", "gray", "pipe:3"}
+
+	// The motion frames are the last output of the recording process, after the live view
+	for _, mode := range []string{config.RecordModeDirect, config.RecordModeReencode} {
+		camera.RecordMode = mode
+		r := &Recorder{Camera: camera, OutputDir: "/recordings/a", LiveDir: "/live/a", pattern: "%Y%m%d-%H%M%S.mkv"}
+
+		_, args := BuildCommand(r)
+		if strings.Count(strings.Join(args, " "), "rtsp://a") != 1 {
+			t.Errorf("%v: expected a single input, got %q", mode, args)
+		}
+		if !slices.Equal(args[len(args)-len(expected):], expected) {
+			t.Errorf("%v: wanted the motion output %q, got %q", mode, expected, args)
+		}
+	}
+}
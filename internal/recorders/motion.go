@@ -0,0 +1,109 @@
+package recorders
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/files"
+	"vigilis/internal/logger"
+	"vigilis/internal/motion"
+	"vigilis/internal/notify"
+)
+
+// motionPipe is the output of the motion frames, the first extra file of the recording process
+const motionPipe = "pipe:3"
+
+// buildMotionArgs builds the output of the recording process that writes low resolution grayscale frames
+// of the camera to motionPipe, so motion is detected without opening another session to the camera
+func buildMotionArgs(camera *config.Camera) []string {
+	m := camera.Motion
+	if m == nil {
+		return nil
+	}
+
+	return slices.Concat(
+		cmdArgs{
+			"-an",
+			"-vf", fmt.Sprintf("fps=%g,scale=%d:%d,format=gray", m.Fps, m.Width, m.Height),
+			"-f", "rawvideo",
+			"-pix_fmt", "gray",
+		},
+		[]string{motionPipe},
+	)
+}
+
+// detectMotion compares the frames written by the recording process until it exits.
+// The frames are read until the end, as ffmpeg blocks once the pipe is full.
+func (r *Recorder) detectMotion(frames io.ReadCloser) {
+	defer frames.Close()
+
+	tracker := motion.NewTracker(r.Camera.Motion.Cooldown)
+	detector := motion.NewDetector(r.Camera.Motion)
+	frame := make([]byte, detector.FrameSize())
+	for {
+		_, err := io.ReadFull(frames, frame)
+		if err != nil {
+			break
+		}
+
+		now := time.Now()
+		changed, moving := detector.Detect(frame)
+
+		started, ended := tracker.Update(now, changed, moving)
+		if started {
+			r.motionStarted(now, changed)
+		}
+		if ended != nil {
+			r.motionEnded(*ended)
+		}
+	}
+
+	// Motion can't be detected until the next process
+	if event := tracker.Stop(); event != nil {
+		r.motionEnded(*event)
+	}
+}
+
+// motionStarted marks the camera as having motion
+func (r *Recorder) motionStarted(now time.Time, changed float64) {
+	r.mu.Lock()
+	r.motion = true
+	r.lastMotionAt = now
+	r.mu.Unlock()
+
+	logger.Info("%v recorder > Motion detected, %.1f%% of the frame changed", r.Camera.Id, changed)
+	if r.buffer != nil {
+		r.buffer.motionStarted(now)
+	}
+	notify.Send(config.EventMotionStart, r.Camera.Id, fmt.Sprintf("Motion detected, %.1f%% of the frame changed", changed))
+}
+
+// motionEnded stores the motion event next to the recordings
+func (r *Recorder) motionEnded(event motion.Event) {
+	r.mu.Lock()
+	r.motion = false
+	r.lastMotionAt = event.End
+	r.mu.Unlock()
+
+	duration := event.End.Sub(event.Start).Round(time.Second)
+	logger.Info("%v recorder > Motion ended after %v", r.Camera.Id, duration)
+
+	motionEvent := files.MotionEvent{
+		CameraId: r.Camera.Id,
+		Start:    event.Start,
+		End:      event.End,
+		Peak:     event.Peak,
+	}
+
+	// The recordings of the motion may still be buffered
+	if r.buffer != nil {
+		r.buffer.motionEnded(motionEvent)
+	} else if err := files.RecordMotion(r.Camera, motionEvent); err != nil {
+		logger.Warn("%v recorder > Error storing the motion event: %v", r.Camera.Id, err)
+	}
+
+	notify.Send(config.EventMotionEnd, r.Camera.Id, fmt.Sprintf("Motion ended after %v, up to %.1f%% of the frame changed",
+		duration, event.Peak))
+}
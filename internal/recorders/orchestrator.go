@@ -1,34 +1,67 @@
 package recorders
 
 import (
-	"os"
+	"context"
+	"errors"
 	"path"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
 	"vigilis/internal/config"
+	"vigilis/internal/files"
 	"vigilis/internal/logger"
 )
 
 const OutputDirPerms = 0700 // only owner has permission
 
+var ErrCameraNotFound = errors.New("camera not found")
+
+// SegmentDirCheckInterval is how often the directories of upcoming recordings are created
+const SegmentDirCheckInterval = time.Minute
+
 var orchestrator = Orchestrator{
-	recorders:     make([]Recorder, 0),
-	startRecorder: make(chan int),
+	recorders:     make([]*Recorder, 0),
+	startRecorder: make(chan *Recorder),
+	stopping:      make(chan struct{}),
 }
 
 type Orchestrator struct {
-	recorders []Recorder
+	mu        sync.Mutex // Protects recorders and retired, which change when the config is reloaded
+	recorders []*Recorder
+	retired   []*Recorder // Recorders of the removed or changed cameras that may still be running
 
-	startRecorder chan int // Index of the recorder to be (re)started
+	startRecorder chan *Recorder // Recorder to be (re)started
+	stopping      chan struct{}  // Closed when the orchestrator is shutting down
+	stopOnce      sync.Once
+
+	lastDirCheck time.Time
 }
 
-func (o *Orchestrator) initializeRecorders(cameras []*config.Camera) {
-	basePath := config.Vigilis.Storage.Path
+func newRecorder(camera *config.Camera) *Recorder {
+	current := config.Current()
+	recorder := &Recorder{
+		Camera:    camera,
+		OutputDir: path.Join(current.Storage.Path, camera.Id),
+		pattern:   current.Storage.SegmentPattern(),
+	}
+
+	// The recordings are buffered until a trigger promotes them to the camera directory
+	if camera.EventRecordingEnabled() {
+		recorder.OutputDir = files.BufferDir(camera)
+		recorder.buffer = newEventBuffer(camera)
+	}
 
-	for i, camera := range cameras {
-		o.recorders = append(o.recorders, Recorder{
-			Camera:    camera,
-			OutputDir: path.Join(basePath, camera.Id),
-			index:     i,
-		})
+	if camera.LiveEnabled() {
+		recorder.LiveDir = path.Join(current.Live.Path, camera.Id)
+	}
+
+	return recorder
+}
+
+func (o *Orchestrator) initializeRecorders(cameras []*config.Camera) {
+	for _, camera := range cameras {
+		o.recorders = append(o.recorders, newRecorder(camera))
 
 		logger.Trace("Recorder for camera %v initialized", camera.Id)
 	}
@@ -42,13 +75,120 @@ func (o *Orchestrator) startRecorders() {
 
 func (o *Orchestrator) ensureRecordingDirectories() {
 	for _, recorder := range o.recorders {
-		cam := recorder.Camera
+		err := recorder.ensureOutputDir()
+		if err != nil {
+			logger.Fatal("Error creating directory for camera %v: %v", recorder.Camera.Id, err)
+		}
+	}
+}
+
+func (o *Orchestrator) isStopping() bool {
+	select {
+	case <-o.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// snapshot returns a copy of the recorders so they can be iterated without holding the lock
+func (o *Orchestrator) snapshot() []*Recorder {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]*Recorder(nil), o.recorders...)
+}
+
+// find returns the recorder of the camera, nil if there is none
+func (o *Orchestrator) find(cameraId string) *Recorder {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, recorder := range o.recorders {
+		if recorder.Camera.Id == cameraId {
+			return recorder
+		}
+	}
+
+	return nil
+}
+
+// reload replaces the recorders of the cameras that changed, leaving the others untouched
+func (o *Orchestrator) reload(cameras []*config.Camera) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	current := make(map[string]*Recorder, len(o.recorders))
+	for _, recorder := range o.recorders {
+		current[recorder.Camera.Id] = recorder
+	}
+
+	// Forget the retired recorders that already stopped
+	o.retired = slices.DeleteFunc(o.retired, func(recorder *Recorder) bool {
+		return !recorder.running()
+	})
+
+	recorders := make([]*Recorder, 0, len(cameras))
+	for _, camera := range cameras {
+		recorder := newRecorder(camera)
+		previous, exists := current[camera.Id]
+		delete(current, camera.Id)
+
+		// Keep the recorders whose settings didn't change
+		if exists && reflect.DeepEqual(previous.Camera, camera) && previous.sameCommand(recorder) {
+			recorders = append(recorders, previous)
+			continue
+		}
+
+		if exists {
+			recorder.reuseProbe(previous)
+			logger.Info("Camera %v changed, restarting its recorder", camera.Id)
+		} else {
+			logger.Info("Camera %v added, starting its recorder", camera.Id)
+		}
 
-		err := os.MkdirAll(recorder.OutputDir, OutputDirPerms)
+		recorders = append(recorders, recorder)
+		if exists {
+			o.retired = append(o.retired, previous)
+		}
+		go replaceRecorder(previous, recorder)
+	}
+
+	for id, recorder := range current {
+		logger.Info("Camera %v removed, stopping its recorder", id)
+		recorder.StopRecording()
+		o.retired = append(o.retired, recorder)
+	}
+
+	o.recorders = recorders
+}
+
+// replaceRecorder starts the new recorder once the previous one, if any, stopped
+// so both processes don't write to the same files
+func replaceRecorder(previous *Recorder, recorder *Recorder) {
+	if previous != nil {
+		previous.StopRecording()
+
+		ctx, cancel := context.WithTimeout(context.Background(), ExitTimeout)
+		defer cancel()
+
+		err := previous.waitExit(ctx.Done())
 		if err != nil {
-			logger.Fatal("Error creating directory for camera %v: %v", cam.Id, err)
+			logger.Warn("%v", err)
 		}
 	}
+
+	err := recorder.ensureOutputDir()
+	if err != nil {
+		logger.Error("Error creating directory for camera %v: %v", recorder.Camera.Id, err)
+		return
+	}
+
+	if orchestrator.isStopping() {
+		return
+	}
+
+	recorder.StartRecording()
 }
 
 // Init starts all recorders
@@ -59,19 +199,154 @@ func Init(cameras []*config.Camera) {
 	// Create directories if needed
 	orchestrator.ensureRecordingDirectories()
 
-	// Start the recorders
+	// Start the recorders, once their stream is probed
 	orchestrator.startRecorders()
 }
 
+// ensureSegmentDirs periodically creates the directories of the upcoming recordings
+func (o *Orchestrator) ensureSegmentDirs() {
+	now := time.Now()
+	if now.Sub(o.lastDirCheck) < SegmentDirCheckInterval {
+		return
+	}
+	o.lastDirCheck = now
+
+	for _, recorder := range o.snapshot() {
+		err := recorder.ensureSegmentDirs(now)
+		if err != nil {
+			logger.Error("%v recorder > Error creating the recordings directory: %v", recorder.Camera.Id, err)
+		}
+	}
+}
+
+// checkOutages notifies the cameras that were not recorded for too long
+func (o *Orchestrator) checkOutages() {
+	threshold := config.DefaultOutageThreshold
+	if notifications := config.Current().Notifications; notifications != nil {
+		threshold = notifications.OutageThreshold
+	}
+
+	now := time.Now()
+	for _, recorder := range o.snapshot() {
+		recorder.checkOutage(now, threshold)
+	}
+}
+
 // Loop takes care of re-starting recorders
 func Loop() {
-	recorders := orchestrator.recorders
+	orchestrator.ensureSegmentDirs()
+	orchestrator.checkOutages()
 
 	select {
 	// Re-start recorder when one goes down
-	case i := <-orchestrator.startRecorder:
-		recorder := recorders[i]
+	case recorder := <-orchestrator.startRecorder:
+		// Don't accept restarts while shutting down
+		if orchestrator.isStopping() {
+			return
+		}
+
+		// The recorder was stopped after the restart was requested
+		if !recorder.claimRestart() {
+			return
+		}
+
 		go recorder.StartRecording()
 	default:
 	}
 }
+
+// Reload applies a new list of cameras, only starting, stopping or restarting
+// the recorders of the cameras that were added, removed or changed
+func Reload(cameras []*config.Camera) {
+	orchestrator.reload(cameras)
+}
+
+// StartCamera starts the recorder of a camera stopped with StopCamera, it does nothing if it's already running.
+// Recorders stopped this way stay stopped until started again or vigilis restarts.
+func StartCamera(cameraId string) error {
+	if orchestrator.isStopping() {
+		return errors.New("vigilis is shutting down")
+	}
+
+	recorder := orchestrator.find(cameraId)
+	if recorder == nil {
+		return ErrCameraNotFound
+	}
+
+	start, err := recorder.claimStart()
+	if err != nil || !start {
+		return err
+	}
+
+	logger.Info("%v recorder > Starting on request", cameraId)
+	go recorder.StartRecording()
+
+	return nil
+}
+
+// StopCamera stops the recorder of a camera and waits for its process to exit, returning an error if it didn't.
+// The recorder isn't restarted until StartCamera is called.
+func StopCamera(cameraId string) error {
+	recorder := orchestrator.find(cameraId)
+	if recorder == nil {
+		return ErrCameraNotFound
+	}
+
+	logger.Info("%v recorder > Stopping on request", cameraId)
+	recorder.StopRecording()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ExitTimeout)
+	defer cancel()
+
+	return recorder.waitExit(ctx.Done())
+}
+
+// Status returns the status of every recorder
+func (o *Orchestrator) Status() []RecorderStatus {
+	recorders := o.snapshot()
+
+	statuses := make([]RecorderStatus, 0, len(recorders))
+	for _, recorder := range recorders {
+		statuses = append(statuses, recorder.Status())
+	}
+
+	return statuses
+}
+
+// Status returns the status of every recorder
+func Status() []RecorderStatus {
+	return orchestrator.Status()
+}
+
+// Shutdown stops all recorders and waits for their processes to exit.
+// The returned error lists the recorders that didn't stop gracefully.
+func Shutdown() error {
+	orchestrator.stopOnce.Do(func() {
+		close(orchestrator.stopping)
+	})
+
+	// The recorders of the removed cameras may still be stopping
+	orchestrator.mu.Lock()
+	recorders := slices.Concat(orchestrator.recorders, orchestrator.retired)
+	orchestrator.mu.Unlock()
+
+	logger.Info("Stopping %d recorder(s)...", len(recorders))
+
+	for _, recorder := range recorders {
+		recorder.StopRecording()
+	}
+
+	// Processes are killed after ExitTimeout, wait until then for them to finish the current segment
+	ctx, cancel := context.WithTimeout(context.Background(), ExitTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, recorder := range recorders {
+		err := recorder.waitExit(ctx.Done())
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
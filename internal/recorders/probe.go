@@ -0,0 +1,260 @@
+package recorders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/ffprobe"
+	"vigilis/internal/logger"
+)
+
+// ProbeTimeout is how long to wait for the camera stream when probing it
+const ProbeTimeout = 20 * time.Second
+
+// StartupProbeTimeout is how long the recorders wait for the camera stream before their first start,
+// far below the segment length as it delays the recording
+const StartupProbeTimeout = 5 * time.Second
+
+// StreamProbe is what was found when probing the stream of a camera
+type StreamProbe struct {
+	Reachable  bool      `json:"reachable"`
+	Error      string    `json:"error,omitempty"` // Why the stream couldn't be probed
+	VideoCodec string    `json:"video_codec,omitempty"`
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	Fps        float64   `json:"fps,omitempty"`
+	Audio      bool      `json:"audio"`
+	AudioCodec string    `json:"audio_codec,omitempty"`
+	Warnings   []string  `json:"warnings,omitempty"` // Incompatibilities of the stream with the camera config
+	ProbedAt   time.Time `json:"probed_at"`
+}
+
+// Codecs that can be copied to the Matroska recordings.
+// G.711 (pcm_alaw and pcm_mulaw), common on cameras, is not played by most players when stored in Matroska.
+var (
+	recordVideoCodecs = []string{"h264", "hevc", "mjpeg", "mpeg4", "mpeg2video", "vp8", "vp9", "av1"}
+	recordAudioCodecs = []string{"aac", "mp3", "opus", "vorbis", "flac", "ac3", "eac3", "pcm_s16le", "pcm_s16be"}
+)
+
+// liveVideoCodecs can be copied to the HLS live view and played by browsers
+var liveVideoCodecs = []string{"h264", "hevc"}
+
+// CheckFfprobe looks for ffprobe, returns false if it's not found
+func CheckFfprobe() bool {
+	fullPath, err := exec.LookPath(config.Current().Recorder.FfprobePath)
+	if err != nil {
+		logger.Warn("ffprobe not found, the camera streams and the recordings won't be probed: %v", err)
+		return false
+	}
+
+	ffprobe.Path = fullPath
+	logger.Trace("ffprobe found at %v", fullPath)
+
+	return true
+}
+
+// ffmpegOnlyInputArgs are the input options of ffmpeg that ffprobe doesn't accept or that only matter when recording,
+// they're left out of the probe with their values
+var ffmpegOnlyInputArgs = []string{
+	"-re", "-readrate", "-stream_loop", "-itsoffset", "-itsscale", "-ss", "-sseof", "-t", "-to", "-r",
+	"-c", "-c:v", "-c:a", "-codec", "-codec:v", "-codec:a", "-hwaccel", "-hwaccel_device", "-hwaccel_output_format",
+	"-thread_queue_size", "-use_wallclock_as_timestamps",
+}
+
+// BuildProbeCommand builds the command that prints the streams of the camera as JSON
+func BuildProbeCommand(camera *config.Camera) (string, []string) {
+	var inputArgs []string
+	for _, option := range config.SplitOptions(camera.InputArgs) {
+		if !slices.Contains(ffmpegOnlyInputArgs, option[0]) {
+			inputArgs = append(inputArgs, option...)
+		}
+	}
+
+	return ffprobe.Command(inputArgs, camera.StreamUrl)
+}
+
+// ProbeCamera probes the stream of the camera with ffprobe
+func ProbeCamera(ctx context.Context, camera *config.Camera) StreamProbe {
+	probe := StreamProbe{ProbedAt: time.Now()}
+
+	path, args := BuildProbeCommand(camera)
+	result, err := ffprobe.Run(ctx, path, args)
+	if err != nil {
+		probe.Error = err.Error()
+		if ctx.Err() != nil {
+			probe.Error = fmt.Sprintf("no response after %v", time.Since(probe.ProbedAt).Round(time.Second))
+		}
+
+		// The stream URL may have credentials
+		probe.Error = strings.ReplaceAll(probe.Error, camera.StreamUrl, redactUrl(camera.StreamUrl))
+		return probe
+	}
+
+	probe.Reachable = true
+	for _, stream := range result.Streams {
+		switch {
+		case stream.CodecType == "video" && probe.VideoCodec == "":
+			probe.VideoCodec = stream.CodecName
+			probe.Width = stream.Width
+			probe.Height = stream.Height
+
+			probe.Fps = parseFrameRate(stream.AvgFrameRate)
+			if probe.Fps == 0 {
+				probe.Fps = parseFrameRate(stream.RFrameRate)
+			}
+		case stream.CodecType == "audio" && !probe.Audio:
+			probe.Audio = true
+			probe.AudioCodec = stream.CodecName
+		}
+	}
+
+	probe.Warnings = compatibilityWarnings(camera, probe)
+
+	return probe
+}
+
+// compatibilityWarnings checks if the streams can be copied by the record mode of the camera
+func compatibilityWarnings(camera *config.Camera, probe StreamProbe) []string {
+	var warnings []string
+
+	if probe.VideoCodec == "" {
+		warnings = append(warnings, "the stream has no video")
+		return warnings
+	}
+
+	mode := recordModes[camera.RecordMode]
+	if mode == RecordModeReencode {
+		return warnings
+	}
+
+	if !slices.Contains(recordVideoCodecs, probe.VideoCodec) {
+		warnings = append(warnings, fmt.Sprintf(
+			"video codec %v can't be copied to the Matroska recordings, use record_mode %v",
+			probe.VideoCodec, config.RecordModeReencode))
+	}
+	if mode == RecordModeDirect && probe.Audio && !slices.Contains(recordAudioCodecs, probe.AudioCodec) {
+		warnings = append(warnings, fmt.Sprintf(
+			"audio codec %v is not supported by the Matroska recordings, use record_mode %v",
+			probe.AudioCodec, config.RecordModeVideoOnly))
+	}
+	if camera.LiveEnabled() && !slices.Contains(liveVideoCodecs, probe.VideoCodec) {
+		warnings = append(warnings, fmt.Sprintf(
+			"video codec %v can't be played in the live view, use record_mode %v",
+			probe.VideoCodec, config.RecordModeReencode))
+	}
+
+	return warnings
+}
+
+// parseFrameRate parses the frame rates of ffprobe, for example 25/1
+func parseFrameRate(rate string) float64 {
+	numerator, denominator, found := strings.Cut(rate, "/")
+	if !found {
+		return 0
+	}
+
+	n, err := strconv.ParseFloat(numerator, 64)
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(denominator, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+
+	return n / d
+}
+
+func redactUrl(streamUrl string) string {
+	parsed, err := url.Parse(streamUrl)
+	if err != nil {
+		return streamUrl
+	}
+
+	return parsed.Redacted()
+}
+
+// probeStream probes the stream of the camera, logging what was found
+func (r *Recorder) probeStream() {
+	if ffprobe.Path == "" {
+		return
+	}
+
+	camId := r.Camera.Id
+
+	ctx, cancel := context.WithTimeout(context.Background(), StartupProbeTimeout)
+	defer cancel()
+
+	r.mu.Lock()
+	r.cancelProbe = cancel
+	r.mu.Unlock()
+
+	probe := ProbeCamera(ctx, r.Camera)
+
+	r.mu.Lock()
+	r.cancelProbe = nil
+	canceled := errors.Is(ctx.Err(), context.Canceled)
+	if !canceled {
+		r.probe = &probe
+	}
+	r.mu.Unlock()
+
+	// Stopped while probing, the stream is probed again on the next start
+	if canceled {
+		return
+	}
+
+	if !probe.Reachable {
+		logger.Error("%v recorder > Unable to probe the camera stream: %v", camId, probe.Error)
+		return
+	}
+
+	logger.Info("%v recorder > Stream probed: %v", camId, probe)
+	for _, warning := range probe.Warnings {
+		logger.Warn("%v recorder > %v", camId, warning)
+	}
+}
+
+// reuseProbe keeps the probe of the previous recorder of the camera when its stream didn't change,
+// so the replaced recorder starts without probing it again
+func (r *Recorder) reuseProbe(previous *Recorder) {
+	previous.mu.Lock()
+	probe := previous.probe
+	previous.mu.Unlock()
+
+	if probe == nil || !probe.Reachable || previous.Camera.StreamUrl != r.Camera.StreamUrl {
+		return
+	}
+
+	// The record mode and the live view may have changed
+	reused := *probe
+	reused.Warnings = compatibilityWarnings(r.Camera, reused)
+
+	r.mu.Lock()
+	r.probe = &reused
+	r.mu.Unlock()
+
+	for _, warning := range reused.Warnings {
+		logger.Warn("%v recorder > %v", r.Camera.Id, warning)
+	}
+}
+
+func (p StreamProbe) String() string {
+	if !p.Reachable {
+		return "unreachable, " + p.Error
+	}
+
+	audio := "no audio"
+	if p.Audio {
+		audio = "audio " + p.AudioCodec
+	}
+
+	return fmt.Sprintf("video %v %dx%d at %.4g fps, %v", p.VideoCodec, p.Width, p.Height, p.Fps, audio)
+}
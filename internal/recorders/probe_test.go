@@ -0,0 +1,105 @@
+package recorders
+
+import (
+	"slices"
+	"testing"
+	"vigilis/internal/config"
+	"vigilis/internal/ffprobe"
+)
+
+func TestCompatibilityWarnings(t *testing.T) {
+	live := true
+
+	cases := []struct {
+		Name     string
+		Camera   config.Camera
+		Probe    StreamProbe
+		Expected []string
+	}{
+		{
+			Name:   "compatible",
+			Camera: config.Camera{RecordMode: config.RecordModeDirect},
+			Probe:  StreamProbe{VideoCodec: "h264", Audio: true, AudioCodec: "aac"},
+		},
+		{
+			Name:     "g711 audio copied",
+			Camera:   config.Camera{RecordMode: config.RecordModeDirect},
+			Probe:    StreamProbe{VideoCodec: "h264", Audio: true, AudioCodec: "pcm_mulaw"},
+			Expected: []string{"audio codec pcm_mulaw is not supported by the Matroska recordings, use record_mode video-only"},
+		},
+		{
+			Name:   "g711 audio dropped",
+			Camera: config.Camera{RecordMode: config.RecordModeVideoOnly},
+			Probe:  StreamProbe{VideoCodec: "h264", Audio: true, AudioCodec: "pcm_mulaw"},
+		},
+		{
+			Name:     "mjpeg live view",
+			Camera:   config.Camera{RecordMode: config.RecordModeVideoOnly, Live: &live},
+			Probe:    StreamProbe{VideoCodec: "mjpeg"},
+			Expected: []string{"video codec mjpeg can't be played in the live view, use record_mode reencode"},
+		},
+		{
+			Name:   "reencoded",
+			Camera: config.Camera{RecordMode: config.RecordModeReencode, Live: &live},
+			Probe:  StreamProbe{VideoCodec: "rawvideo"},
+		},
+		{
+			Name:     "no video",
+			Camera:   config.Camera{RecordMode: config.RecordModeDirect},
+			Probe:    StreamProbe{Audio: true, AudioCodec: "aac"},
+			Expected: []string{"the stream has no video"},
+		},
+	}
+
+	for _, caseData := range cases {
+		warnings := compatibilityWarnings(&caseData.Camera, caseData.Probe)
+		if !slices.Equal(warnings, caseData.Expected) {
+			t.Errorf("%v: wanted %q, got %q", caseData.Name, caseData.Expected, warnings)
+		}
+	}
+}
+
+func TestBuildProbeCommand(t *testing.T) {
+	camera := &config.Camera{
+		StreamUrl: "rtsp://a",
+		InputArgs: []string{"-rtsp_transport", "tcp", "-use_wallclock_as_timestamps", "1", "-re", "-timeout", "5000000", "-itsoffset", "-1"},
+	}
+
+	_, args := BuildProbeCommand(camera)
+	_, expected := ffprobe.Command([]string{"-rtsp_transport", "tcp", "-timeout", "5000000"}, "rtsp://a")
+	if !slices.Equal(args, expected) {
+		t.Errorf("wanted %q, got %q", expected, args)
+	}
+}
+
+func TestReuseProbe(t *testing.T) {
+	live := true
+	probe := &StreamProbe{Reachable: true, VideoCodec: "mjpeg"}
+
+	cases := []struct {
+		Name     string
+		Previous *StreamProbe
+		Url      string
+		Reused   bool
+	}{
+		{Name: "unchanged", Previous: probe, Url: "rtsp://camera/stream", Reused: true},
+		{Name: "url changed", Previous: probe, Url: "rtsp://camera/other"},
+		{Name: "unreachable", Previous: &StreamProbe{Error: "timeout"}, Url: "rtsp://camera/stream"},
+		{Name: "not probed", Url: "rtsp://camera/stream"},
+	}
+
+	for _, caseData := range cases {
+		previous := &Recorder{Camera: &config.Camera{Id: "a", StreamUrl: "rtsp://camera/stream"}, probe: caseData.Previous}
+		recorder := &Recorder{Camera: &config.Camera{Id: "a", StreamUrl: caseData.Url, Live: &live}}
+		recorder.reuseProbe(previous)
+
+		if reused := recorder.probe != nil; reused != caseData.Reused {
+			t.Errorf("%v: wanted reused %v, got %v", caseData.Name, caseData.Reused, reused)
+			continue
+		}
+		// The warnings follow the new camera config
+		if caseData.Reused && len(recorder.probe.Warnings) != 1 {
+			t.Errorf("%v: wanted the live view warning, got %q", caseData.Name, recorder.probe.Warnings)
+		}
+	}
+}
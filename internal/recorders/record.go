@@ -3,86 +3,369 @@ package recorders
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"path"
+	"slices"
+	"sync"
 	"time"
 	"vigilis/internal/config"
 	"vigilis/internal/logger"
+	"vigilis/internal/notify"
 	"vigilis/internal/util"
 )
 
 const ExitTimeout = 5 * time.Second
 
+// KillGracePeriod is how long to wait for a process to exit after it was killed
+const KillGracePeriod = time.Second
+
 const (
-	ExitReasonStop = "stop requested"
+	ExitReasonStop  = "stop requested"
+	ExitReasonStall = "no data received"
 )
 
+// SegmentDirLookahead is how long before they are needed the directories of upcoming recordings are created
+const SegmentDirLookahead = 5 * time.Minute
+
+// StderrTailLines is how many lines of stderr are logged when the process fails
+const StderrTailLines = 10
+
 type Recorder struct {
 	Camera    *config.Camera
 	OutputDir string
-	index     int
+	LiveDir   string       // Empty when the live view is disabled
+	pattern   string       // strftime pattern of the recordings, relative to OutputDir
+	buffer    *eventBuffer // Promotes the recordings written to OutputDir, nil without the events record
+
+	// Process related data, protected by mu
+	mu            sync.Mutex
+	state         RecorderState
+	stopRequested bool          // Stopped while starting, the process is stopped once spawned
+	cancelProbe   func()        // Cancels the probe of the stream before the first start, nil otherwise
+	spawning      chan struct{} // Closed once the process of the last start attempt is spawned, or failed to
+	process       *os.Process
+	exited        chan struct{} // Closed when the process exited and its segments were indexed
+	motionDone    chan struct{} // Closed when the motion detection stopped after the process exited
+	args          []string      // Arguments of the last process
+	startedAt     time.Time
+	restarts      restartState
+	lastError     string
+	probe         *StreamProbe // Nil until the stream is probed
+
+	// Outage of the camera, protected by mu
+	downSince      time.Time // When the process exited unexpectedly, zero once it runs for HealthyRunTime
+	outageNotified bool
 
-	// Process related data
-	process *os.Process
-	stdout  bytes.Buffer
-	stderr  bytes.Buffer
+	// Motion of the camera, protected by mu
+	motion       bool
+	lastMotionAt time.Time
+
+	// Completed segments of all processes, protected by mu
+	lastSegmentAt time.Time
 }
 
 // StartRecording starts a new recording
-func (r Recorder) StartRecording() {
+func (r *Recorder) StartRecording() {
 	camId := r.Camera.Id
 
+	r.mu.Lock()
+	// Started by Init or a reload, otherwise claimed by claimStart or claimRestart
+	if r.state != StateStarting {
+		r.markStarting()
+	}
+	spawning := r.spawning
+	probed := r.probe != nil
+	r.mu.Unlock()
+
+	// The stream is probed before the first process, as some cameras only accept one session at a time
+	if !probed {
+		r.probeStream()
+
+		r.mu.Lock()
+		if r.stopRequested {
+			r.state = StateIdle
+			r.stopRequested = false
+			r.mu.Unlock()
+			close(spawning)
+			return
+		}
+		r.mu.Unlock()
+	}
+
+	// The directories of the recordings depend on the time
+	err := r.ensureSegmentDirs(time.Now())
+	if err != nil {
+		logger.Error("%v recorder > Error creating the recordings directory: %v", camId, err)
+	}
+
 	// Prepare the command
 	path, args := BuildCommand(r)
 
+	r.mu.Lock()
+	r.args = args
+	r.mu.Unlock()
+
+	segmentList := newSegmentListWriter(r)
+
+	// Only read once the process exited
+	var stderr bytes.Buffer
 	cmd := exec.Command(path, args...)
-	cmd.Stdout = &r.stdout
-	cmd.Stderr = &r.stderr
+	cmd.Stdout = segmentList
+	cmd.Stderr = &stderr
 
 	// Run the command
-	err := cmd.Start()
+	frames, err := startProcess(cmd, r.Camera.Motion != nil)
 	if err != nil {
+		segmentList.Close()
 		logger.Error("%v recorder > Error spawning %v process: %v", camId, cmd.Args[0], err)
-		// TODO Try again but not forever
+
+		r.mu.Lock()
+		r.lastError = err.Error()
+		stopRequested := r.stopRequested
+		if stopRequested {
+			r.state = StateIdle
+			r.stopRequested = false
+		}
+		r.mu.Unlock()
+		close(spawning)
+
+		if !stopRequested {
+			r.scheduleRestart()
+		}
 		return
 	}
 
+	exited := make(chan struct{})
+	motionDone := make(chan struct{})
+
+	r.mu.Lock()
 	r.process = cmd.Process
+	r.exited = exited
+	r.motionDone = motionDone
+	r.startedAt = time.Now()
+	r.state = StateRecording
+	stopRequested := r.stopRequested
+	r.stopRequested = false
+	r.mu.Unlock()
+	close(spawning)
+
+	// The recorder was stopped, or the orchestrator started shutting down, while the process was spawning
+	if stopRequested || orchestrator.isStopping() {
+		r.StopRecording()
+	}
 
 	pid := cmd.Process.Pid
 	logger.Info("%v recorder > Process spawned with PID %d", camId, pid)
 
+	// Reset the backoff once the process has been running for a while
+	healthy := time.AfterFunc(HealthyRunTime, r.markHealthy)
+
+	// Restart the process if the camera stops sending data
+	go r.watch(exited, config.Current().Recorder.StallTimeout)
+
+	// Detect motion while recording
+	go func() {
+		if frames != nil {
+			r.detectMotion(frames)
+		}
+		if r.buffer != nil {
+			r.buffer.flushMotion()
+		}
+		close(motionDone)
+	}()
+
 	// Wait for the command to exit
 	cmdErr := cmd.Wait()
 
-	// Start the new process as soon as this one exits to avoid loosing footage
-	r.restart()
+	// The last segment is indexed before the exit is signaled, so it's listed once the recorder stopped
+	segmentList.Close()
+	close(exited)
+	healthy.Stop()
+
+	r.mu.Lock()
+	stopping := r.state == StateStopping
+	if stopping {
+		r.state = StateIdle
+	}
+	r.process = nil
+	r.startedAt = time.Time{}
+	r.mu.Unlock()
 
 	// Log errors, exclude interruptions
-	if cmdErr != nil && cmdErr.Error() != "signal: interrupt" {
+	if cmdErr != nil && !stopping && cmdErr.Error() != "signal: interrupt" {
 		logger.Error("%v recorder > Process %d exited with error: %v", camId, pid, cmdErr)
 
-		util.LogBuffer(r.stderr, "stderr", logger.Info, camId+" recorder")
-		return
+		r.mu.Lock()
+		r.lastError = cmdErr.Error()
+		r.mu.Unlock()
+
+		util.LogBufferTail(stderr, StderrTailLines, "stderr", logger.Info, camId+" recorder")
+	} else {
+		logger.Info("%v recorder > Recording stopped", camId)
 	}
 
-	logger.Info("%v recorder > Recording stopped", camId)
+	// Start the new process as soon as possible to avoid loosing footage
+	if !stopping {
+		r.scheduleRestart()
+	}
 }
 
-// StopRecording stops the recording by exiting the process
-func (r Recorder) StopRecording() {
+// startProcess starts the recording process, with the pipe of the motion frames as its first extra file
+// when motion is detected. The returned frames are nil otherwise.
+func startProcess(cmd *exec.Cmd, motion bool) (*os.File, error) {
+	if !motion {
+		return nil, cmd.Start()
+	}
+
+	frames, framesWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	// Only the process keeps writing the frames, so they end when it exits
+	defer framesWriter.Close()
+
+	cmd.ExtraFiles = []*os.File{framesWriter}
+	err = cmd.Start()
+	if err != nil {
+		frames.Close()
+		return nil, err
+	}
+
+	return frames, nil
+}
+
+// sameCommand checks if the other recorder would run the same command as the last process of this one
+func (r *Recorder) sameCommand(other *Recorder) bool {
+	_, args := BuildCommand(other)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Equal(r.args, args)
+}
+
+// segmentDir returns the directory of the recording started at the given time
+func (r *Recorder) segmentDir(t time.Time) string {
+	return path.Dir(path.Join(r.OutputDir, util.Strftime(r.pattern, t)))
+}
+
+// ensureSegmentDirs creates the directories of the current recordings and the upcoming ones,
+// as ffmpeg doesn't create them
+func (r *Recorder) ensureSegmentDirs(now time.Time) error {
+	for _, t := range []time.Time{now, now.Add(SegmentDirLookahead)} {
+		err := os.MkdirAll(r.segmentDir(t), OutputDirPerms)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureOutputDir creates the output directories if needed
+func (r *Recorder) ensureOutputDir() error {
+	err := r.ensureSegmentDirs(time.Now())
+	if err != nil {
+		return err
+	}
+
+	if r.LiveDir != "" {
+		return os.MkdirAll(r.LiveDir, OutputDirPerms)
+	}
+
+	return nil
+}
+
+// StopRecording stops the recording by exiting the process, once spawned if it's starting
+func (r *Recorder) StopRecording() {
+	r.mu.Lock()
+
+	// A stopped recorder is not down, and the error of its last process is stale
+	r.downSince = time.Time{}
+	r.outageNotified = false
+	r.lastError = ""
+
+	switch {
+	case r.state == StateStarting:
+		// The process is stopped by StartRecording once spawned, or not spawned when stopped while probing
+		r.stopRequested = true
+		if r.cancelProbe != nil {
+			r.cancelProbe()
+		}
+		r.mu.Unlock()
+		return
+	case r.process == nil:
+		// Cancel pending restarts
+		if r.state == StateBackoff || r.state == StateFailed {
+			r.state = StateIdle
+		}
+		r.mu.Unlock()
+		return
+	}
+
+	r.state = StateStopping
+	r.mu.Unlock()
+
 	r.exit(ExitReasonStop)
 }
 
+// claimStart marks a stopped recorder as starting, returning false if it's already running or waiting to restart
+func (r *Recorder) claimStart() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case r.state == StateStopping:
+		return false, errors.New("the recorder is still stopping")
+	case r.state != StateIdle || r.process != nil:
+		return false, nil
+	}
+
+	r.markStarting()
+	return true, nil
+}
+
+// claimRestart marks a recorder waiting to restart as starting, returning false if it was stopped in the meantime
+func (r *Recorder) claimRestart() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state != StateBackoff && r.state != StateFailed {
+		return false
+	}
+
+	r.markStarting()
+	return true
+}
+
+// markStarting starts a new start attempt, mu must be held
+func (r *Recorder) markStarting() {
+	r.state = StateStarting
+	r.stopRequested = false
+	r.spawning = make(chan struct{})
+}
+
 // exit tries to gracefully exit the process, forcing it after a while if needed
-func (r Recorder) exit(reason string) {
+func (r *Recorder) exit(reason string) {
 	camId := r.Camera.Id
-	pid := r.process.Pid
+
+	r.mu.Lock()
+	process := r.process
+	r.mu.Unlock()
+
+	// The process already exited
+	if process == nil {
+		return
+	}
+
+	pid := process.Pid
 
 	logger.Trace("%v recorder > Gracefully stopping recorder (PID: %d): %v", camId, pid, reason)
 
 	// Try to gracefully exit the process
-	err := r.process.Signal(os.Interrupt)
+	err := process.Signal(os.Interrupt)
 	if err != nil {
 		logger.Warn("%v recorder > Error sending interrupt to process with PID %d: %v", camId, pid, err)
 	}
@@ -90,7 +373,7 @@ func (r Recorder) exit(reason string) {
 	// Check the process after a while
 	time.AfterFunc(ExitTimeout, func() {
 		// Try to kill the process
-		err = r.process.Kill()
+		err = process.Kill()
 		if err != nil {
 			if errors.Is(err, os.ErrProcessDone) { // Process is already finished
 				logger.Trace("%v recorder > Recording stopped gracefully before timeout (PID %d)", camId, pid)
@@ -105,8 +388,159 @@ func (r Recorder) exit(reason string) {
 	})
 }
 
+// waitExit waits for the process to exit, returning an error if it didn't before the done channel was closed.
+// A process being spawned is waited for too.
+func (r *Recorder) waitExit(done <-chan struct{}) error {
+	r.mu.Lock()
+	spawning := r.spawning
+	r.mu.Unlock()
+
+	// The process exits right after being spawned when it was stopped while starting
+	if spawning != nil {
+		select {
+		case <-spawning:
+		case <-done:
+			return fmt.Errorf("%v recorder was still starting", r.Camera.Id)
+		}
+	}
+
+	r.mu.Lock()
+	exited := r.exited
+	motionDone := r.motionDone
+	r.mu.Unlock()
+
+	// The process was never started
+	if exited == nil {
+		return nil
+	}
+
+	select {
+	case <-exited:
+		// The ongoing motion event is stored once the motion detection stopped
+		select {
+		case <-motionDone:
+		case <-done:
+		}
+		return nil
+	case <-done:
+	}
+
+	// The process is killed after the exit timeout, give it a moment to be reaped
+	select {
+	case <-exited:
+		return fmt.Errorf("%v recorder did not stop before the timeout and was killed", r.Camera.Id)
+	case <-time.After(KillGracePeriod):
+		return fmt.Errorf("%v recorder did not stop", r.Camera.Id)
+	}
+}
+
+// markHealthy resets the backoff of a recorder whose process is running
+func (r *Recorder) markHealthy() {
+	r.mu.Lock()
+	recovered := r.restarts.success() || r.outageNotified
+	r.downSince = time.Time{}
+	r.outageNotified = false
+	r.lastError = ""
+	r.mu.Unlock()
+
+	if recovered {
+		logger.Info("%v recorder > Recovered, the process has been running for %v", r.Camera.Id, HealthyRunTime)
+		notify.Send(config.EventRecorderRecovered, r.Camera.Id,
+			fmt.Sprintf("Recovered, the process has been running for %v", HealthyRunTime))
+	}
+}
+
+// scheduleRestart records the failure and restarts the process after the backoff delay
+func (r *Recorder) scheduleRestart() {
+	camId := r.Camera.Id
+
+	r.mu.Lock()
+	wasFailed := r.restarts.failed
+	delay := r.restarts.failure(time.Now())
+	attempts := r.restarts.attempts
+	failed := r.restarts.failed
+	lastError := r.lastError
+
+	if r.downSince.IsZero() {
+		r.downSince = time.Now()
+	}
+	r.state = StateBackoff
+	if failed {
+		r.state = StateFailed
+	}
+	r.mu.Unlock()
+
+	addStats(camId, RecorderStats{Restarts: 1})
+
+	switch {
+	case failed && !wasFailed:
+		logger.Error("%v recorder > Failed %d times within %v, marking it as failed and retrying every %v",
+			camId, attempts, FailureWindow, RecoveryProbeInterval)
+		notify.Send(config.EventRecorderFailed, camId, fmt.Sprintf("Failed %d times within %v, retrying every %v: %v",
+			attempts, FailureWindow, RecoveryProbeInterval, lastError))
+	case failed:
+		logger.Warn("%v recorder > Still failing, retrying in %v", camId, delay)
+	case delay > 0:
+		logger.Warn("%v recorder > Restarting in %v (attempt %d/%d)",
+			camId, delay.Round(time.Millisecond), attempts, MaxRestartAttempts)
+	}
+
+	if delay == 0 {
+		r.restart()
+		return
+	}
+
+	time.AfterFunc(delay, r.restart)
+}
+
+// checkOutage notifies once when the camera was not recorded for the threshold
+func (r *Recorder) checkOutage(now time.Time, threshold time.Duration) {
+	r.mu.Lock()
+	downSince := r.downSince
+	outage := !downSince.IsZero() && !r.outageNotified && now.Sub(downSince) >= threshold
+	if outage {
+		r.outageNotified = true
+	}
+	lastError := r.lastError
+	r.mu.Unlock()
+
+	if !outage {
+		return
+	}
+
+	down := now.Sub(downSince).Round(time.Second)
+	logger.Error("%v recorder > Not recorded for %v: %v", r.Camera.Id, down, lastError)
+	notify.Send(config.EventCameraOutage, r.Camera.Id, fmt.Sprintf("Not recorded for %v, since %v: %v",
+		down, downSince.Local().Format(time.DateTime), lastError))
+}
+
+// running checks if the recorder has a process, or is spawning one
+func (r *Recorder) running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.process != nil || r.state == StateStarting
+}
+
+// waitingRestart checks if the recorder is waiting to be restarted
+func (r *Recorder) waitingRestart() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.state == StateBackoff || r.state == StateFailed
+}
+
 // restart signals the orchestrator to (re)start the process
-func (r Recorder) restart() {
+func (r *Recorder) restart() {
+	// The recorder was stopped while waiting
+	if !r.waitingRestart() {
+		return
+	}
+
 	// TODO Increase channel count?
-	orchestrator.startRecorder <- r.index
+	select {
+	case orchestrator.startRecorder <- r:
+	case <-orchestrator.stopping:
+		// Don't block when the orchestrator is shutting down
+	}
 }
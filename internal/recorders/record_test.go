@@ -0,0 +1,125 @@
+package recorders
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/ffprobe"
+)
+
+func TestStopWhileStarting(t *testing.T) {
+	// Records until interrupted
+	script := path.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexec sleep 30\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	previousPath := Ffmpeg.Path
+	Ffmpeg.Path = script
+	defer func() {
+		Ffmpeg.Path = previousPath
+	}()
+
+	config.Apply(&config.VigilisConfig{Recorder: &config.Recorder{StallTimeout: time.Minute}})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+	}()
+
+	r := &Recorder{
+		Camera:    &config.Camera{Id: "a", SegmentSeconds: 10},
+		OutputDir: t.TempDir(),
+		pattern:   "%Y%m%d-%H%M%S.mkv",
+	}
+
+	start, err := r.claimStart()
+	if !start || err != nil {
+		t.Fatalf("expected the recorder to be claimed, got %v %v", start, err)
+	}
+
+	// Stopped before the process is spawned
+	r.StopRecording()
+
+	stopped := make(chan struct{})
+	go func() {
+		r.StartRecording()
+		close(stopped)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ExitTimeout)
+	defer cancel()
+
+	if err := r.waitExit(ctx.Done()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected the recording to stop")
+	}
+
+	status := r.Status()
+	if status.State != StateIdle || status.Pid != 0 || !status.StartedAt.IsZero() {
+		t.Errorf("expected the recorder to be idle, got %v with PID %d started at %v", status.State, status.Pid, status.StartedAt)
+	}
+}
+
+func TestStopWhileProbing(t *testing.T) {
+	dir := t.TempDir()
+	spawned := path.Join(dir, "spawned")
+
+	// The probe never responds, and the recording process leaves a trace
+	ffprobeScript := path.Join(dir, "ffprobe")
+	ffmpegScript := path.Join(dir, "ffmpeg")
+	if err := os.WriteFile(ffprobeScript, []byte("#!/bin/sh\nexec sleep 30\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ffmpegScript, []byte("#!/bin/sh\ntouch "+spawned+"\nexec sleep 30\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	previousFfprobe, previousFfmpeg := ffprobe.Path, Ffmpeg.Path
+	ffprobe.Path, Ffmpeg.Path = ffprobeScript, ffmpegScript
+	defer func() {
+		ffprobe.Path, Ffmpeg.Path = previousFfprobe, previousFfmpeg
+	}()
+
+	config.Apply(&config.VigilisConfig{Recorder: &config.Recorder{StallTimeout: time.Minute}})
+	defer func() {
+		config.Apply(&config.VigilisConfig{})
+	}()
+
+	r := &Recorder{
+		Camera:    &config.Camera{Id: "a", SegmentSeconds: 10},
+		OutputDir: t.TempDir(),
+		pattern:   "%Y%m%d-%H%M%S.mkv",
+	}
+
+	go r.StartRecording()
+
+	// Stopped once the probe runs
+	for probing := false; !probing; time.Sleep(10 * time.Millisecond) {
+		r.mu.Lock()
+		probing = r.cancelProbe != nil
+		r.mu.Unlock()
+	}
+	r.StopRecording()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ExitTimeout)
+	defer cancel()
+
+	if err := r.waitExit(ctx.Done()); err != nil {
+		t.Fatal(err)
+	}
+
+	status := r.Status()
+	if status.State != StateIdle || status.Probe != nil {
+		t.Errorf("expected the recorder to be idle and not probed, got %v with probe %v", status.State, status.Probe)
+	}
+	if _, err := os.Stat(spawned); err == nil {
+		t.Error("expected the recording process not to be spawned")
+	}
+}
@@ -0,0 +1,143 @@
+package recorders
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"vigilis/internal/files"
+	"vigilis/internal/logger"
+)
+
+// segmentListArgs make ffmpeg write each completed segment to stdout, so it's added to the index
+var segmentListArgs = cmdArgs{
+	"-segment_list", "pipe:1",
+	"-segment_list_type", "csv",
+}
+
+// SegmentQueueSize is how many completed segments can wait to be indexed before ffmpeg's output is blocked
+const SegmentQueueSize = 16
+
+// segmentListWriter receives the segment list written by ffmpeg, one CSV line per completed segment
+type segmentListWriter struct {
+	recorder *Recorder
+	buffer   bytes.Buffer
+	lines    chan string   // Completed segments, indexed in the background as probing them takes a while
+	done     chan struct{} // Closed once the completed segments were indexed
+}
+
+func newSegmentListWriter(r *Recorder) *segmentListWriter {
+	w := &segmentListWriter{
+		recorder: r,
+		lines:    make(chan string, SegmentQueueSize),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+
+	return w
+}
+
+func (w *segmentListWriter) run() {
+	defer close(w.done)
+
+	for line := range w.lines {
+		w.recorder.segmentCompleted(line)
+	}
+}
+
+// Close waits for the completed segments to be indexed, once ffmpeg doesn't write anymore
+func (w *segmentListWriter) Close() error {
+	close(w.lines)
+	<-w.done
+
+	return nil
+}
+
+func (w *segmentListWriter) Write(p []byte) (int, error) {
+	w.buffer.Write(p)
+
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// Keep the incomplete line for the next write
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			break
+		}
+
+		w.lines <- strings.TrimSpace(line)
+	}
+
+	return len(p), nil
+}
+
+// segmentCompleted indexes the segment from a line of the segment list: file name, start and end time
+func (r *Recorder) segmentCompleted(line string) {
+	camId := r.Camera.Id
+
+	record, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err == nil && len(record) != 3 {
+		err = errors.New("unexpected number of fields")
+	}
+	if err != nil {
+		logger.Warn("%v recorder > Error reading the segment list line %q: %v", camId, line, err)
+		return
+	}
+
+	start, startErr := strconv.ParseFloat(record[1], 64)
+	end, endErr := strconv.ParseFloat(record[2], 64)
+	if startErr != nil || endErr != nil {
+		logger.Warn("%v recorder > Invalid times in the segment list line %q", camId, line)
+		return
+	}
+	duration := time.Duration((end - start) * float64(time.Second))
+
+	name, info, err := r.findSegment(record[0], duration)
+	if err != nil {
+		logger.Warn("%v recorder > Error finding the completed segment %v: %v", camId, record[0], err)
+		return
+	}
+
+	r.mu.Lock()
+	r.lastSegmentAt = info.ModTime()
+	r.mu.Unlock()
+
+	addStats(camId, RecorderStats{SegmentsCompleted: 1, BytesWritten: info.Size()})
+
+	if r.buffer != nil {
+		r.buffer.completed(name, duration)
+		return
+	}
+
+	err = files.IndexRecording(r.Camera, name, duration)
+	if err != nil {
+		logger.Warn("%v recorder > Error indexing the completed segment %v: %v", camId, name, err)
+		return
+	}
+
+	logger.Trace("%v recorder > Segment %v completed and indexed", camId, name)
+}
+
+// findSegment returns the path relative to the output directory and the info of a segment that just completed,
+// as ffmpeg only lists the file name
+func (r *Recorder) findSegment(filename string, duration time.Duration) (string, os.FileInfo, error) {
+	now := time.Now()
+
+	// The segment started in the directory of either its start time or the current time
+	for _, t := range []time.Time{now.Add(-duration), now} {
+		segmentPath := path.Join(r.segmentDir(t), filename)
+
+		info, err := os.Stat(segmentPath)
+		if err == nil {
+			name, err := filepath.Rel(r.OutputDir, segmentPath)
+			return filepath.ToSlash(name), info, err
+		}
+	}
+
+	return "", nil, os.ErrNotExist
+}
@@ -0,0 +1,70 @@
+package recorders
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+	"vigilis/internal/config"
+)
+
+// SnapshotTimeout is how long to wait for a picture of the camera
+const SnapshotTimeout = 15 * time.Second
+
+// snapshotArgs write the first frame of the stream as a JPEG
+var snapshotArgs = cmdArgs{
+	"-an",
+	"-frames:v", "1",
+	"-q:v", "3",
+	"-f", "image2",
+	"-vcodec", "mjpeg",
+}
+
+// BuildSnapshotCommand builds the command that writes a JPEG picture of the camera to stdout
+func BuildSnapshotCommand(camera *config.Camera) (string, []string) {
+	return Ffmpeg.Path,
+		slices.Concat(
+			globalArgs,
+			camera.InputArgs,
+			[]string{"-i", camera.StreamUrl},
+			snapshotArgs,
+			[]string{"pipe:1"},
+		)
+}
+
+// Snapshot grabs a JPEG picture from the stream of the camera
+func Snapshot(ctx context.Context, cameraId string) ([]byte, error) {
+	camera := config.Current().FindCamera(cameraId)
+	if camera == nil {
+		return nil, ErrCameraNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, SnapshotTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	path, args := BuildSnapshotCommand(camera)
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stderr = &stderr
+
+	picture, err := cmd.Output()
+	if err == nil && len(picture) == 0 {
+		err = errors.New("no picture received")
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if ctx.Err() != nil {
+			message = "no picture after " + SnapshotTimeout.String()
+		} else if message == "" {
+			message = err.Error()
+		}
+
+		// The stream URL may have credentials
+		return nil, errors.New(strings.ReplaceAll(message, camera.StreamUrl, redactUrl(camera.StreamUrl)))
+	}
+
+	return picture, nil
+}
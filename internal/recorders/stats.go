@@ -0,0 +1,36 @@
+package recorders
+
+import "sync"
+
+// RecorderStats are the totals of the recorders of a camera since vigilis started.
+// They're kept by camera id as the recorders are replaced when the config is reloaded.
+type RecorderStats struct {
+	Restarts          int
+	SegmentsCompleted int
+	BytesWritten      int64
+}
+
+var (
+	statsMu sync.Mutex
+	stats   = make(map[string]RecorderStats)
+)
+
+// addStats adds to the totals of the camera
+func addStats(cameraId string, add RecorderStats) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	total := stats[cameraId]
+	total.Restarts += add.Restarts
+	total.SegmentsCompleted += add.SegmentsCompleted
+	total.BytesWritten += add.BytesWritten
+	stats[cameraId] = total
+}
+
+// GetStats returns the totals of the camera
+func GetStats(cameraId string) RecorderStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	return stats[cameraId]
+}
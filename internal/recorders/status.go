@@ -0,0 +1,90 @@
+package recorders
+
+import (
+	"time"
+)
+
+type RecorderState int
+
+const (
+	StateIdle      RecorderState = iota // Not started or stopped on request
+	StateStarting                       // Spawning the process
+	StateRecording                      // The process is running
+	StateStopping                       // Waiting for the process to exit after a stop request
+	StateBackoff                        // Waiting to restart after the process exited
+	StateFailed                         // Failed too many times, waiting for the next recovery attempt
+)
+
+var recorderStateNames = map[RecorderState]string{
+	StateIdle:      "idle",
+	StateStarting:  "starting",
+	StateRecording: "recording",
+	StateStopping:  "stopping",
+	StateBackoff:   "backoff",
+	StateFailed:    "failed",
+}
+
+func (s RecorderState) String() string {
+	return recorderStateNames[s]
+}
+
+// MarshalText makes the state readable when encoded, for example as JSON
+func (s RecorderState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// RecorderStatus is a snapshot of the state of a recorder
+type RecorderStatus struct {
+	CameraId  string        `json:"camera_id"`
+	State     RecorderState `json:"state"`
+	Pid       int           `json:"pid,omitempty"`        // Set while the process is running
+	StartedAt time.Time     `json:"started_at,omitzero"`  // When the current process was spawned
+	Restarts  int           `json:"restarts"`             // Restarts since vigilis started
+	LastError string        `json:"last_error,omitempty"` // Why the last process failed, until it recovers or is stopped
+	Probe     *StreamProbe  `json:"probe,omitempty"`      // Streams of the camera, once probed
+
+	SegmentsCompleted int       `json:"segments_completed"`       // Segments completed since vigilis started
+	BytesWritten      int64     `json:"bytes_written"`            // Size of the completed segments
+	LastSegmentAt     time.Time `json:"last_segment_at,omitzero"` // When the last segment was completed
+
+	Motion       bool      `json:"motion"`                  // Motion is ongoing, always false without motion detection
+	LastMotionAt time.Time `json:"last_motion_at,omitzero"` // When motion was last seen
+
+	TriggeredUntil time.Time `json:"triggered_until,omitzero"` // Until when the recordings are kept, with the events record
+}
+
+// Status returns the status of the recorder
+func (r *Recorder) Status() RecorderStatus {
+	stats := GetStats(r.Camera.Id)
+
+	var triggeredUntil time.Time
+	if r.buffer != nil {
+		triggeredUntil = r.buffer.triggeredUntil(time.Now())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := RecorderStatus{
+		CameraId:  r.Camera.Id,
+		State:     r.state,
+		StartedAt: r.startedAt,
+		Restarts:  stats.Restarts,
+		LastError: r.lastError,
+		Probe:     r.probe,
+
+		SegmentsCompleted: stats.SegmentsCompleted,
+		BytesWritten:      stats.BytesWritten,
+		LastSegmentAt:     r.lastSegmentAt,
+
+		Motion:       r.motion,
+		LastMotionAt: r.lastMotionAt,
+
+		TriggeredUntil: triggeredUntil,
+	}
+	if r.process != nil {
+		status.Pid = r.process.Pid
+	}
+
+	return status
+}
@@ -0,0 +1,121 @@
+package recorders
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"vigilis/internal/config"
+	"vigilis/internal/files"
+	"vigilis/internal/logger"
+	"vigilis/internal/notify"
+	"vigilis/internal/util"
+)
+
+// StallCheckInterval is how often the watchdog checks the recording output
+const StallCheckInterval = 5 * time.Second
+
+// watch exits the process when no data is written to the output directory
+// for longer than the stall timeout, so it's restarted by the orchestrator
+func (r *Recorder) watch(exited <-chan struct{}, timeout time.Duration) {
+	camId := r.Camera.Id
+
+	ticker := time.NewTicker(StallCheckInterval)
+	defer ticker.Stop()
+
+	var (
+		lastName   string
+		lastSize   int64
+		lastGrowth = time.Now()
+	)
+
+	for {
+		select {
+		case <-exited:
+			return
+		case now := <-ticker.C:
+			name, size, err := r.latestRecording(now, timeout)
+			if err != nil {
+				logger.Warn("%v recorder > Error checking the recording output: %v", camId, err)
+				continue
+			}
+
+			// A new segment was started or the current one grew
+			if name != lastName || size != lastSize {
+				lastName, lastSize, lastGrowth = name, size, now
+				continue
+			}
+
+			if now.Sub(lastGrowth) >= timeout {
+				logger.Warn("%v recorder > No data written for %v, the camera stream stalled", camId, timeout)
+				notify.Send(config.EventStallDetected, camId,
+					fmt.Sprintf("No data written for %v, restarting the recorder", timeout))
+				r.exit(ExitReasonStall)
+				return
+			}
+		}
+	}
+}
+
+// latestRecording returns the path and size of the most recently modified recording in the directories
+// where the process could have been writing to since the stall timeout.
+// Only the recordings started since then are checked, the directories may hold the whole retention.
+func (r *Recorder) latestRecording(now time.Time, timeout time.Duration) (string, int64, error) {
+	dirs := []string{r.segmentDir(now)}
+	if previous := r.segmentDir(now.Add(-timeout)); previous != dirs[0] {
+		dirs = append(dirs, previous)
+	}
+
+	// The recordings may be longer than the segment length, to start with a keyframe
+	segmentLength := time.Duration(r.Camera.SegmentSeconds) * time.Second
+	limit := now.Add(-timeout - 2*segmentLength)
+
+	var (
+		latest    os.FileInfo
+		latestDir string
+	)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			// Purged or not created yet
+			continue
+		}
+		if err != nil {
+			return "", 0, err
+		}
+
+		for _, entry := range entries {
+			// Motion events are written next to the recordings
+			if !entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), files.MotionSuffix) {
+				continue
+			}
+
+			name, err := filepath.Rel(r.OutputDir, path.Join(dir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			start, err := util.ParseStrftime(r.pattern, filepath.ToSlash(name), time.Local)
+			if err != nil || start.Before(limit) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				// The file may have been purged in the meantime
+				continue
+			}
+
+			if latest == nil || info.ModTime().After(latest.ModTime()) {
+				latest, latestDir = info, dir
+			}
+		}
+	}
+
+	if latest == nil {
+		return "", 0, nil
+	}
+
+	return path.Join(latestDir, latest.Name()), latest.Size(), nil
+}
@@ -0,0 +1,42 @@
+package recorders
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+	"vigilis/internal/config"
+)
+
+func TestLatestRecording(t *testing.T) {
+	r := &Recorder{
+		Camera:    &config.Camera{Id: "a", SegmentSeconds: 10},
+		OutputDir: t.TempDir(),
+		pattern:   "%Y%m%d-%H%M%S.mkv",
+	}
+
+	now := time.Now().Truncate(time.Second)
+	write := func(start time.Time, size int) string {
+		name := path.Join(r.OutputDir, start.Format("20060102-150405")+".mkv")
+		if err := os.WriteFile(name, make([]byte, size), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	current := write(now.Add(-5*time.Second), 100)
+	if err := os.Chtimes(current, now.Add(-time.Minute), now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Older recordings are skipped, even when they were modified later
+	write(now.Add(-time.Hour), 200)
+
+	name, size, err := r.latestRecording(now, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != current || size != 100 {
+		t.Errorf("wanted %v with 100 bytes, got %v with %d bytes", current, name, size)
+	}
+}
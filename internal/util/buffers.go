@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"strings"
 	"vigilis/internal/logger"
 )
 
@@ -18,3 +19,20 @@ func LogBuffer(buffer bytes.Buffer, bufferName string, logFunc logger.LogFunctio
 		logFunc("%v > %v", prefix, string(output))
 	}
 }
+
+// LogBufferTail logs the last lines of the buffer, prefixing them with how many were skipped
+func LogBufferTail(buffer bytes.Buffer, lines int, bufferName string, logFunc logger.LogFunction, prefix string) {
+	output := strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n")
+	if len(output) == 1 && output[0] == "" {
+		return
+	}
+
+	if skipped := len(output) - lines; skipped > 0 {
+		logFunc("%v > Last %d line(s) of %v (%d skipped)", prefix, lines, bufferName, skipped)
+		output = output[skipped:]
+	}
+
+	for _, line := range output {
+		logFunc("%v > %v", prefix, line)
+	}
+}
@@ -0,0 +1,127 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// strftimeWidths are the supported strftime directives, as used by ffmpeg, and their width
+var strftimeWidths = map[byte]int{
+	'Y': 4,
+	'm': 2,
+	'd': 2,
+	'H': 2,
+	'M': 2,
+	'S': 2,
+}
+
+// CheckStrftime checks if the format only uses supported directives, returning the ones used
+func CheckStrftime(format string) ([]byte, error) {
+	var directives []byte
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+
+		if i+1 >= len(format) {
+			return nil, fmt.Errorf("incomplete directive at the end of %q", format)
+		}
+
+		i++
+		if _, ok := strftimeWidths[format[i]]; !ok && format[i] != '%' {
+			return nil, fmt.Errorf("unsupported directive %%%c in %q", format[i], format)
+		}
+
+		directives = append(directives, format[i])
+	}
+
+	return directives, nil
+}
+
+// Strftime formats the time using a strftime format
+func Strftime(format string, t time.Time) string {
+	values := map[byte]int{
+		'Y': t.Year(),
+		'm': int(t.Month()),
+		'd': t.Day(),
+		'H': t.Hour(),
+		'M': t.Minute(),
+		'S': t.Second(),
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			result.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		width, ok := strftimeWidths[format[i]]
+		if !ok {
+			// Unsupported directives and %% are written as is
+			result.WriteByte(format[i])
+			continue
+		}
+
+		fmt.Fprintf(&result, "%0*d", width, values[format[i]])
+	}
+
+	return result.String()
+}
+
+// ParseStrftime parses a value formatted with a strftime format.
+// Directives that are not in the format default to the start of their range.
+func ParseStrftime(format string, value string, loc *time.Location) (time.Time, error) {
+	values := map[byte]int{'Y': 1, 'm': 1, 'd': 1}
+
+	pos := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) || format[i+1] == '%' {
+			if format[i] == '%' && i+1 < len(format) {
+				i++ // %% matches a single %
+			}
+
+			if pos >= len(value) || value[pos] != format[i] {
+				return time.Time{}, fmt.Errorf("%q doesn't match %q", value, format)
+			}
+			pos++
+			continue
+		}
+
+		i++
+		width, ok := strftimeWidths[format[i]]
+		if !ok {
+			return time.Time{}, fmt.Errorf("unsupported directive %%%c in %q", format[i], format)
+		}
+
+		if pos+width > len(value) {
+			return time.Time{}, fmt.Errorf("%q doesn't match %q", value, format)
+		}
+
+		number, err := strconv.Atoi(value[pos : pos+width])
+		if err != nil || strings.ContainsAny(value[pos:pos+width], "+-") {
+			return time.Time{}, fmt.Errorf("%q doesn't match %q", value, format)
+		}
+
+		values[format[i]] = number
+		pos += width
+	}
+
+	if pos != len(value) {
+		return time.Time{}, fmt.Errorf("%q doesn't match %q", value, format)
+	}
+
+	t := time.Date(values['Y'], time.Month(values['m']), values['d'], values['H'], values['M'], values['S'], 0, loc)
+
+	// Reject out of range values, which time.Date normalizes
+	if t.Month() != time.Month(values['m']) || t.Day() != values['d'] || t.Hour() != values['H'] ||
+		t.Minute() != values['M'] || t.Second() != values['S'] {
+		return time.Time{}, fmt.Errorf("%q is not a valid time for %q", value, format)
+	}
+
+	return t, nil
+}
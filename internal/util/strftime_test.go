@@ -0,0 +1,97 @@
+package util
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCheckStrftime(t *testing.T) {
+	cases := []struct {
+		Format        string
+		Expected      []byte
+		ExpectedError string
+	}{
+		{Format: "%Y%m%d-%H%M%S.mkv", Expected: []byte("YmdHMS")},
+		{Format: "%Y/%m/%d/%H%M%S.mkv", Expected: []byte("YmdHMS")},
+		{Format: "100%%", Expected: []byte("%")},
+		{Format: "%j.mkv", ExpectedError: `unsupported directive %j in "%j.mkv"`},
+		{Format: "%Y%", ExpectedError: `incomplete directive at the end of "%Y%"`},
+	}
+
+	for _, caseData := range cases {
+		t.Run(caseData.Format, func(t *testing.T) {
+			directives, err := CheckStrftime(caseData.Format)
+			if caseData.ExpectedError != "" {
+				if err == nil || err.Error() != caseData.ExpectedError {
+					t.Errorf("wanted error %q, got %v", caseData.ExpectedError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(directives, caseData.Expected) {
+				t.Errorf("wanted %q, got %q", caseData.Expected, directives)
+			}
+		})
+	}
+}
+
+func TestStrftime(t *testing.T) {
+	date := time.Date(2025, time.March, 7, 9, 5, 3, 0, time.UTC)
+
+	cases := []struct {
+		Format   string
+		Expected string
+	}{
+		{Format: "%Y%m%d-%H%M%S.mkv", Expected: "20250307-090503.mkv"},
+		{Format: "%Y/%m/%d/%H%M%S.mkv", Expected: "2025/03/07/090503.mkv"},
+		{Format: "cam_1-%Y.mkv", Expected: "cam_1-2025.mkv"},
+		{Format: "100%%", Expected: "100%"},
+	}
+
+	for _, caseData := range cases {
+		if result := Strftime(caseData.Format, date); result != caseData.Expected {
+			t.Errorf("%v: wanted %q, got %q", caseData.Format, caseData.Expected, result)
+		}
+	}
+}
+
+func TestParseStrftime(t *testing.T) {
+	cases := []struct {
+		Format   string
+		Value    string
+		Expected time.Time
+		Invalid  bool
+	}{
+		{Format: "%Y%m%d-%H%M%S.mkv", Value: "20250307-090503.mkv", Expected: time.Date(2025, time.March, 7, 9, 5, 3, 0, time.UTC)},
+		{Format: "%Y/%m/%d/%H%M%S.mkv", Value: "2025/03/07/090503.mkv", Expected: time.Date(2025, time.March, 7, 9, 5, 3, 0, time.UTC)},
+		{Format: "cam_1-%Y.mkv", Value: "cam_1-2025.mkv", Expected: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{Format: "%Y%m%d-%H%M%S.mkv", Value: "notes.txt", Invalid: true},
+		{Format: "%Y%m%d-%H%M%S.mkv", Value: "20250307-090503.mkv.part", Invalid: true},
+		{Format: "%Y%m%d-%H%M%S.mkv", Value: "20251307-090503.mkv", Invalid: true},
+		{Format: "%Y%m%d-%H%M%S.mkv", Value: "2025+307-090503.mkv", Invalid: true},
+		{Format: "%Y/%m/%d/%H%M%S.mkv", Value: "../../../etc/passwd", Invalid: true},
+	}
+
+	for _, caseData := range cases {
+		t.Run(caseData.Value, func(t *testing.T) {
+			result, err := ParseStrftime(caseData.Format, caseData.Value, time.UTC)
+			if caseData.Invalid {
+				if err == nil {
+					t.Errorf("wanted an error, got %v", result)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !result.Equal(caseData.Expected) {
+				t.Errorf("wanted %v, got %v", caseData.Expected, result)
+			}
+		})
+	}
+}